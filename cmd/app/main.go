@@ -11,6 +11,7 @@ import (
 	"os"
 	"sw/config"
 	"sw/internal/auth"
+	"sw/internal/auth/keys"
 	"sw/internal/database"
 	"sw/internal/identity"
 	"sw/internal/mail/console"
@@ -32,6 +33,10 @@ func main() {
 	if err != nil {
 		logger.Fatal(err)
 	}
+	keyRing, err := newKeyRing(cfg.JWT, secret)
+	if err != nil {
+		logger.Fatal(err)
+	}
 	db, err := database.New(connectionString, migrationsSrc, logger)
 	if err != nil {
 		logger.Fatal(err)
@@ -52,9 +57,9 @@ func main() {
 	//	logger.Println(err)
 	//	c.Response().WriteHeader(http.StatusInternalServerError)
 	//}
-	e.Use(auth.Authentication(secret))
+	e.Use(auth.Authentication(keyRing, cfg.JWT.Audience))
 
-	err = identity.Initialize(e, logger, validate, cfg, secret, db, emailer)
+	err = identity.Initialize(e, logger, validate, cfg, keyRing, db, emailer)
 	if err != nil {
 		logger.Fatal(err)
 	}
@@ -64,3 +69,18 @@ func main() {
 		logger.Fatal(err)
 	}
 }
+
+func newKeyRing(opt config.JwtOptions, secret []byte) (*keys.KeyRing, error) {
+	if len(opt.SigningKeys) == 0 {
+		return keys.NewKeyRing(keys.ScheduledKey{Key: keys.NewSecretKey(secret)})
+	}
+	scheduled := make([]keys.ScheduledKey, 0, len(opt.SigningKeys))
+	for _, k := range opt.SigningKeys {
+		key, err := keys.Load(k.ID, k.Algorithm, k.PrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		scheduled = append(scheduled, keys.ScheduledKey{Key: key, ActiveFrom: k.ActiveFrom, RetireAt: k.RetireAt})
+	}
+	return keys.NewKeyRing(scheduled...)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/lib/pq"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sw/config"
+	"sw/internal/database"
+	"sw/internal/identity/crypto"
+	"time"
+)
+
+const (
+	appConfigPath = "config/app.yml"
+	migrationsSrc = "file://migrations"
+)
+
+// record is an account of the legacy system. The password hash is kept as is, in any encoding the
+// configured hasher recognizes, and gets replaced on the first sign-in.
+type record struct {
+	Email          string    `json:"email"`
+	PasswordHash   string    `json:"password_hash"`
+	EmailConfirmed bool      `json:"email_confirmed"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Bulk loads accounts from a CSV file with a header row or from a JSONL file, one object per line,
+// with the fields email, password_hash, and optionally email_confirmed and created_at (RFC 3339).
+// Invalid records and emails which already have an account are skipped and reported.
+//
+//	import -file users.csv
+//	import -file users.jsonl
+func main() {
+	connectionString := os.Getenv("SW_CONNECTION_STRING")
+
+	var path string
+	var format string
+	flag.StringVar(&path, "file", "", "file to import")
+	flag.StringVar(&format, "format", "", "csv or jsonl, detected from the file extension by default")
+	flag.Parse()
+
+	logger := log.Default()
+	if path == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+	cfg, err := config.ReadConfig(appConfigPath)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	hasher, err := crypto.NewHasher(cfg.PasswordHashing)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}(file)
+
+	var records []record
+	switch format {
+	case "csv":
+		records, err = readCSV(file)
+	case "jsonl":
+		records, err = readJSONL(file)
+	default:
+		err = fmt.Errorf("unsupported format: %q", format)
+	}
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	validate := validator.New()
+	valid := make([]record, 0, len(records))
+	for i, r := range records {
+		err = validate.Var(r.Email, "required,max=320,email")
+		if err != nil {
+			logger.Printf("Record %d skipped, invalid email: %q", i+1, r.Email)
+			continue
+		}
+		if !hasher.Identifies(r.PasswordHash) {
+			logger.Printf("Record %d skipped, unsupported or malformed password hash: %s", i+1, r.Email)
+			continue
+		}
+		if r.CreatedAt.IsZero() {
+			r.CreatedAt = time.Now()
+		}
+		valid = append(valid, r)
+	}
+
+	db, err := database.New(connectionString, migrationsSrc, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}(db)
+
+	imported, err := load(db, valid)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Printf("Imported: %d, skipped: %d", imported, int64(len(records))-imported)
+}
+
+func readCSV(r io.Reader) ([]record, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, errors.New("csv: missing email column")
+	}
+	if _, ok := columns["password_hash"]; !ok {
+		return nil, errors.New("csv: missing password_hash column")
+	}
+
+	records := make([]record, 0)
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		r := record{Email: row[columns["email"]], PasswordHash: row[columns["password_hash"]]}
+		if i, ok := columns["email_confirmed"]; ok && row[i] != "" {
+			r.EmailConfirmed, err = strconv.ParseBool(row[i])
+			if err != nil {
+				return nil, fmt.Errorf("csv: line %d: %w", len(records)+2, err)
+			}
+		}
+		if i, ok := columns["created_at"]; ok && row[i] != "" {
+			r.CreatedAt, err = time.Parse(time.RFC3339, row[i])
+			if err != nil {
+				return nil, fmt.Errorf("csv: line %d: %w", len(records)+2, err)
+			}
+		}
+		records = append(records, r)
+	}
+}
+
+func readJSONL(r io.Reader) ([]record, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	records := make([]record, 0)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r record
+		err := json.Unmarshal(scanner.Bytes(), &r)
+		if err != nil {
+			return nil, fmt.Errorf("jsonl: line %d: %w", line, err)
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// load copies the records into a temporary table first, so a duplicate email skips the record
+// instead of failing the whole import.
+func load(db *sql.DB, records []record) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `CREATE TEMP TABLE account_import
+				(
+					email citext NOT NULL,
+					email_confirmed boolean NOT NULL,
+					password_hash varchar(255) NOT NULL,
+					created_at timestamp NOT NULL
+				) ON COMMIT DROP`
+	_, err = tx.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := tx.Prepare(pq.CopyIn("account_import", "email", "email_confirmed", "password_hash", "created_at"))
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range records {
+		_, err = stmt.Exec(r.Email, r.EmailConfirmed, r.PasswordHash, r.CreatedAt.UTC())
+		if err != nil {
+			return 0, err
+		}
+	}
+	_, err = stmt.Exec()
+	if err != nil {
+		return 0, err
+	}
+	err = stmt.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	query = `INSERT INTO account (email, email_confirmed, password_hash, created_at)
+				SELECT DISTINCT ON (email) email, email_confirmed, password_hash, created_at
+				FROM account_import
+				ORDER BY email
+				ON CONFLICT (email) DO NOTHING`
+	result, err := tx.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+	imported, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return imported, tx.Commit()
+}
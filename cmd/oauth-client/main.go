@@ -0,0 +1,122 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	_ "github.com/lib/pq"
+	"log"
+	"os"
+	"strings"
+	"sw/config"
+	"sw/internal/database"
+	"sw/internal/identity/crypto"
+	"sw/internal/random"
+	"time"
+)
+
+const (
+	appConfigPath = "config/app.yml"
+	migrationsSrc = "file://migrations"
+)
+
+type redirectURIs []string
+
+func (r *redirectURIs) String() string {
+	return strings.Join(*r, ",")
+}
+
+func (r *redirectURIs) Set(value string) error {
+	*r = append(*r, value)
+	return nil
+}
+
+// Registers an OAuth client and prints its id, and for a confidential client its secret:
+//
+//	oauth-client -name spa -redirect-uri https://my-frontend/callback
+//	oauth-client -name worker -confidential -scope "orders:read orders:write"
+func main() {
+	connectionString := os.Getenv("SW_CONNECTION_STRING")
+
+	var name string
+	var uris redirectURIs
+	var confidential bool
+	var scope string
+	flag.StringVar(&name, "name", "", "client name")
+	flag.Var(&uris, "redirect-uri", "allowed redirect uri, can be repeated")
+	flag.BoolVar(&confidential, "confidential", false, "generate a client secret")
+	flag.StringVar(&scope, "scope", "", "space separated scopes granted to the client")
+	flag.Parse()
+
+	logger := log.Default()
+	if name == "" || (len(uris) == 0 && !confidential) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cfg, err := config.ReadConfig(appConfigPath)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	// The secret is verified with the configured hasher, which may differ from the default or be peppered.
+	hasher, err := crypto.NewHasher(cfg.PasswordHashing)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	db, err := database.New(connectionString, migrationsSrc, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer func(db *sql.DB) {
+		err := db.Close()
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}(db)
+
+	var secret string
+	var secretHash *string
+	if confidential {
+		secret = random.Secret(32)
+		hash, err := hasher.Hash(secret)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		secretHash = &hash
+	}
+	clientID, err := register(db, name, uris, secretHash, strings.Join(strings.Fields(scope), " "))
+	if err != nil {
+		logger.Fatal(err)
+	}
+	fmt.Println("client_id:", clientID)
+	if confidential {
+		// The secret is stored hashed only, this is the one chance to see it.
+		fmt.Println("client_secret:", secret)
+	}
+}
+
+func register(db *sql.DB, name string, uris []string, secretHash *string, scope string) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	clientID := random.Secret(24)
+	query := `INSERT INTO oauth_client (client_id, name, created_at, secret_hash, scopes)
+				VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	var id int64
+	err = tx.QueryRow(query, clientID, name, time.Now().UTC(), secretHash, scope).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+	for _, uri := range uris {
+		query = "INSERT INTO oauth_client_redirect_uri VALUES (DEFAULT, $1, $2)"
+		_, err = tx.Exec(query, id, uri)
+		if err != nil {
+			return "", err
+		}
+	}
+	return clientID, tx.Commit()
+}
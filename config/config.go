@@ -3,16 +3,143 @@ package config
 import (
 	"gopkg.in/yaml.v3"
 	"os"
+	"time"
 )
 
 type Config struct {
-	Port string     `yaml:"port"`
-	JWT  JwtOptions `yaml:"jwt"`
+	Port            string                 `yaml:"port"`
+	JWT             JwtOptions             `yaml:"jwt"`
+	OAuth           OAuthOptions           `yaml:"oauth"`
+	PasswordHashing PasswordHashingOptions `yaml:"password_hashing"`
+	PasswordPolicy  PasswordPolicyOptions  `yaml:"password_policy"`
+	MFA             MFAOptions             `yaml:"mfa"`
+	WebAuthn        WebAuthnOptions        `yaml:"webauthn"`
+	EmailOTP        EmailOTPOptions        `yaml:"email_otp"`
 }
 
 type JwtOptions struct {
-	AccessTokenLifetimeMinutes int `yaml:"access_token_lifetime_minutes"`
-	RefreshTokenLifetimeDays   int `yaml:"refresh_token_lifetime_days"`
+	Issuer                           string              `yaml:"issuer"`
+	Audience                         string              `yaml:"audience"`
+	AccessTokenLifetimeMinutes       int                 `yaml:"access_token_lifetime_minutes"`
+	RefreshTokenLifetimeDays         int                 `yaml:"refresh_token_lifetime_days"`
+	ClientAccessTokenLifetimeMinutes int                 `yaml:"client_access_token_lifetime_minutes"`
+	SigningKeys                      []SigningKeyOptions `yaml:"signing_keys"`
+}
+
+// SigningKeyOptions configures an asymmetric signing key. Without any keys tokens are signed HS256
+// with the shared secret. To rotate, add the new key with active_from in the future and set
+// retire_at of the old one to at least an access token lifetime after that.
+type SigningKeyOptions struct {
+	ID             string    `yaml:"id"`
+	Algorithm      string    `yaml:"algorithm"`
+	PrivateKeyPath string    `yaml:"private_key_path"`
+	ActiveFrom     time.Time `yaml:"active_from"`
+	RetireAt       time.Time `yaml:"retire_at"`
+}
+
+type OAuthOptions struct {
+	// LoginURL is the frontend page which collects credentials for an authorization request.
+	LoginURL                         string `yaml:"login_url"`
+	AuthorizationCodeLifetimeSeconds int    `yaml:"authorization_code_lifetime_seconds"`
+	// DeviceVerificationURL is the frontend page where a signed-in account enters the user code.
+	DeviceVerificationURL        string `yaml:"device_verification_url"`
+	DeviceCodeLifetimeSeconds    int    `yaml:"device_code_lifetime_seconds"`
+	DevicePollingIntervalSeconds int    `yaml:"device_polling_interval_seconds"`
+}
+
+// PasswordHashingOptions selects the algorithm new password hashes are made with. Hashes made by
+// the other one, or with weaker parameters, are replaced on sign-in.
+type PasswordHashingOptions struct {
+	Algorithm  string          `yaml:"algorithm"`
+	BcryptCost int             `yaml:"bcrypt_cost"`
+	Argon2id   Argon2idOptions `yaml:"argon2id"`
+	Peppers    []PepperOptions `yaml:"peppers"`
+}
+
+// PepperOptions configures a secret mixed into passwords before hashing, kept out of the database.
+// New hashes use the highest version. To rotate, add a new version and keep the old one until the
+// hashes made with it were replaced on sign-in.
+type PepperOptions struct {
+	Version    int    `yaml:"version"`
+	SecretPath string `yaml:"secret_path"`
+}
+
+type Argon2idOptions struct {
+	MemoryKiB   uint32 `yaml:"memory_kib"`
+	Iterations  uint32 `yaml:"iterations"`
+	Parallelism uint8  `yaml:"parallelism"`
+	SaltLength  uint32 `yaml:"salt_length"`
+	KeyLength   uint32 `yaml:"key_length"`
+}
+
+// PasswordPolicyOptions configures the rules new passwords are checked against on sign-up, reset and change.
+type PasswordPolicyOptions struct {
+	MinLength        int  `yaml:"min_length"`
+	MaxLength        int  `yaml:"max_length"`
+	RequireLowercase bool `yaml:"require_lowercase"`
+	RequireUppercase bool `yaml:"require_uppercase"`
+	RequireDigit     bool `yaml:"require_digit"`
+	RequireSymbol    bool `yaml:"require_symbol"`
+	// BannedPasswords are rejected regardless of case, together with the ones listed one per line
+	// in the BannedPasswordsPath file.
+	BannedPasswords     []string `yaml:"banned_passwords"`
+	BannedPasswordsPath string   `yaml:"banned_passwords_path"`
+	// RejectSimilarToEmail rejects passwords containing the local part of the email, or contained by it.
+	RejectSimilarToEmail bool `yaml:"reject_similar_to_email"`
+	// MinStrengthBits is the lowest estimated entropy accepted, 0 disables the check.
+	MinStrengthBits   float64                  `yaml:"min_strength_bits"`
+	BreachedPasswords BreachedPasswordsOptions `yaml:"breached_passwords"`
+	// HistorySize is how many of the last passwords, the current one included, can't be chosen again.
+	// 0 disables the check and the history is not kept.
+	HistorySize int `yaml:"history_size"`
+}
+
+// BreachedPasswordsOptions configures the check of new passwords against public breaches. Mode "range"
+// queries a Have I Been Pwned compatible k-anonymity range API at RangeURL, which may be a local mirror,
+// and mode "file" looks the hash up in a file of SHA-1 hashes sorted ascending, one per line, optionally
+// followed by ":<count>". An empty mode disables the check.
+type BreachedPasswordsOptions struct {
+	Mode     string `yaml:"mode"`
+	RangeURL string `yaml:"range_url"`
+	// TimeoutSeconds bounds a range API request, 3 seconds when not set.
+	TimeoutSeconds int    `yaml:"timeout_seconds"`
+	FilePath       string `yaml:"file_path"`
+	// MinCount is how many times a password must have been seen in breaches to be rejected.
+	MinCount int `yaml:"min_count"`
+}
+
+type MFAOptions struct {
+	// TOTPIssuer names the service in authenticator apps.
+	TOTPIssuer string `yaml:"totp_issuer"`
+	// ChallengeLifetimeSeconds is how long a sign-in waits for the second factor after the password.
+	ChallengeLifetimeSeconds int `yaml:"challenge_lifetime_seconds"`
+	// MaxAttempts is the number of wrong codes after which the challenge is void.
+	MaxAttempts int `yaml:"max_attempts"`
+	// MaxFailures is the number of wrong codes in a row, over all challenges and the OAuth authorization,
+	// after which the account is locked out.
+	MaxFailures int `yaml:"max_failures"`
+	// LockoutSeconds is how long no code is accepted after a lockout.
+	LockoutSeconds int `yaml:"lockout_seconds"`
+}
+
+// WebAuthnOptions describes the relying party passkeys are registered for. The RPID is the domain of
+// the frontend, or a registrable suffix of it, and Origins are the exact origins the ceremonies may
+// run on.
+type WebAuthnOptions struct {
+	RPID                     string   `yaml:"rp_id"`
+	RPName                   string   `yaml:"rp_name"`
+	Origins                  []string `yaml:"origins"`
+	ChallengeLifetimeSeconds int      `yaml:"challenge_lifetime_seconds"`
+}
+
+// EmailOTPOptions rules the codes sent by email to sign in or to confirm the email, in place of a link.
+type EmailOTPOptions struct {
+	// CodeLifetimeSeconds is how long a code can be entered after it was sent.
+	CodeLifetimeSeconds int `yaml:"code_lifetime_seconds"`
+	// MaxAttempts is the number of wrong codes after which the account is locked out.
+	MaxAttempts int `yaml:"max_attempts"`
+	// LockoutSeconds is how long no code is sent or accepted after a lockout.
+	LockoutSeconds int `yaml:"lockout_seconds"`
 }
 
 func ReadConfig(src string) (Config, error) {
@@ -4,8 +4,8 @@ go 1.23.2
 
 require (
 	github.com/go-playground/validator/v10 v10.23.0
-	github.com/golang-migrate/migrate/v4 v4.18.1
 	github.com/golang-jwt/jwt/v5 v5.2.1
+	github.com/golang-migrate/migrate/v4 v4.18.1
 	github.com/labstack/echo/v4 v4.12.0
 	github.com/lib/pq v1.10.9
 	golang.org/x/crypto v0.29.0
@@ -1,23 +1,30 @@
 package auth
 
 import (
+	"errors"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
+	"sw/internal/auth/keys"
 )
 
-func Authentication(secret []byte) echo.MiddlewareFunc {
+// Token types, set as the typ header, so a token issued for one purpose is refused for another.
+// Access tokens follow RFC 9068, ID tokens keep the plain type clients expect.
+const (
+	TypeAccessToken = "at+jwt"
+	TypeIDToken     = "JWT"
+)
+
+// Authentication accepts access tokens of accounts only. ID tokens are signed with the same keys but
+// are meant for clients to read, and tokens of clients acting on their own behalf have no account.
+func Authentication(keyRing *keys.KeyRing, audience string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			tokenString := c.Request().Header.Get("Authorization")
 			if tokenString != "" {
 				tokenString = tokenString[len("Bearer "):]
-				token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-					return secret, nil
-				})
-				if err == nil {
-					if token.Valid {
-						c.Set("claims", token.Claims)
-					}
+				claims, err := ParseAccessToken(keyRing, audience, tokenString)
+				if err == nil && !IsClientToken(claims) {
+					c.Set("claims", claims)
 				}
 			}
 
@@ -28,3 +35,53 @@ func Authentication(secret []byte) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// ParseAccessToken verifies the signature of the token with the key selected by its kid and validates the
+// claims. Only access tokens issued to the audience are accepted.
+func ParseAccessToken(keyRing *keys.KeyRing, audience string, tokenString string) (jwt.MapClaims, error) {
+	token, err := parse(keyRing, tokenString, jwt.WithAudience(audience))
+	if err != nil {
+		return nil, err
+	}
+	if typ, _ := token.Header["typ"].(string); typ != TypeAccessToken {
+		return nil, TokenTypeError
+	}
+	return token.Claims.(jwt.MapClaims), nil
+}
+
+// IsClientToken tells whether the subject of the token is the client itself rather than an account,
+// see RFC 9068, section 2.2.
+func IsClientToken(claims jwt.MapClaims) bool {
+	clientID, ok := claims["client_id"].(string)
+	if !ok {
+		return false
+	}
+	sub, _ := claims.GetSubject()
+	return sub == clientID
+}
+
+func parse(keyRing *keys.KeyRing, tokenString string, options ...jwt.ParserOption) (*jwt.Token, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keyRing.Verification(kid)
+		if !ok {
+			return nil, UnknownKeyError
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, jwt.ErrTokenSignatureInvalid
+		}
+		return key.Public, nil
+	}, options...)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return token, nil
+}
+
+var (
+	UnknownKeyError = errors.New("token is signed with an unknown key")
+	TokenTypeError  = errors.New("token is not an access token")
+)
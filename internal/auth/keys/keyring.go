@@ -0,0 +1,88 @@
+package keys
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ScheduledKey is a key of the ring. It signs tokens from ActiveFrom until a newer key becomes active
+// and is accepted for verification until RetireAt. Zero times mean "since always" and "never".
+type ScheduledKey struct {
+	Key
+	ActiveFrom time.Time
+	RetireAt   time.Time
+}
+
+// KeyRing selects keys by time, so a rotation only needs a new key scheduled ahead and the old one
+// retired after the last token it signed has expired.
+type KeyRing struct {
+	keys []ScheduledKey
+}
+
+func NewKeyRing(keys ...ScheduledKey) (*KeyRing, error) {
+	if len(keys) == 0 {
+		return nil, EmptyKeyRingError
+	}
+	ids := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		if _, ok := ids[k.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id: %q", k.ID)
+		}
+		ids[k.ID] = struct{}{}
+		if !k.RetireAt.IsZero() && !k.RetireAt.After(k.ActiveFrom) {
+			return nil, fmt.Errorf("key %q retires before it becomes active", k.ID)
+		}
+	}
+	sorted := make([]ScheduledKey, len(keys))
+	copy(sorted, keys)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ActiveFrom.After(sorted[j].ActiveFrom)
+	})
+	return &KeyRing{keys: sorted}, nil
+}
+
+// Signing returns the most recently activated key which hasn't retired yet.
+func (r *KeyRing) Signing() (Key, error) {
+	now := time.Now()
+	for _, k := range r.keys {
+		if !k.ActiveFrom.After(now) && !retired(k, now) {
+			return k.Key, nil
+		}
+	}
+	return Key{}, NoActiveKeyError
+}
+
+// Verification looks up a key accepted for verification by its id. Keys scheduled for the future are
+// accepted already, as other instances may have switched to them a bit earlier.
+func (r *KeyRing) Verification(id string) (Key, bool) {
+	now := time.Now()
+	for _, k := range r.keys {
+		if k.ID == id && !retired(k, now) {
+			return k.Key, true
+		}
+	}
+	return Key{}, false
+}
+
+// Published returns every key which isn't retired, so verifiers can cache upcoming keys in advance.
+func (r *KeyRing) Published() []Key {
+	now := time.Now()
+	keys := make([]Key, 0, len(r.keys))
+	for _, k := range r.keys {
+		if !retired(k, now) {
+			keys = append(keys, k.Key)
+		}
+	}
+	return keys
+}
+
+func retired(k ScheduledKey, now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+var (
+	EmptyKeyRingError = errors.New("key ring has no keys")
+	NoActiveKeyError  = errors.New("key ring has no active signing key")
+)
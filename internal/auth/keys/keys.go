@@ -0,0 +1,159 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"os"
+)
+
+// Key is a JWT signing key together with the key used to verify its signatures.
+// For HMAC both are the same shared secret.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.PrivateKey
+	Public  crypto.PublicKey
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func NewSecretKey(secret []byte) Key {
+	return Key{Method: jwt.SigningMethodHS256, Private: secret, Public: secret}
+}
+
+// Load reads a PEM encoded private key for the given algorithm. When id is empty the key id
+// is derived from the public key as its RFC 7638 thumbprint.
+func Load(id string, algorithm string, path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+	key := Key{ID: id, Method: jwt.GetSigningMethod(algorithm)}
+	switch m := key.Method.(type) {
+	case *jwt.SigningMethodRSA:
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+		if err != nil {
+			return Key{}, err
+		}
+		key.Private, key.Public = private, &private.PublicKey
+	case *jwt.SigningMethodECDSA:
+		private, err := jwt.ParseECPrivateKeyFromPEM(data)
+		if err != nil {
+			return Key{}, err
+		}
+		if private.Curve.Params().BitSize != m.CurveBits {
+			return Key{}, fmt.Errorf("%s requires a %d bit curve", algorithm, m.CurveBits)
+		}
+		key.Private, key.Public = private, &private.PublicKey
+	case *jwt.SigningMethodEd25519:
+		private, err := jwt.ParseEdPrivateKeyFromPEM(data)
+		if err != nil {
+			return Key{}, err
+		}
+		key.Private, key.Public = private, private.(ed25519.PrivateKey).Public()
+	default:
+		return Key{}, fmt.Errorf("unsupported signing algorithm: %q", algorithm)
+	}
+	if key.ID == "" {
+		key.ID, err = thumbprint(key)
+		if err != nil {
+			return Key{}, err
+		}
+	}
+	return key, nil
+}
+
+// JWK returns the public part of the key. Symmetric keys can't be published.
+func (k Key) JWK() (JWK, error) {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+	switch public := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encode(public.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		key, err := public.ECDH()
+		if err != nil {
+			return JWK{}, err
+		}
+		// Uncompressed point: 0x04 || X || Y
+		point := key.Bytes()[1:]
+		size := len(point) / 2
+		jwk.Kty = "EC"
+		jwk.Crv = public.Curve.Params().Name
+		jwk.X = encode(point[:size])
+		jwk.Y = encode(point[size:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encode(public)
+	default:
+		return JWK{}, SymmetricKeyError
+	}
+	return jwk, nil
+}
+
+func thumbprint(k Key) (string, error) {
+	jwk, err := k.JWK()
+	if err != nil {
+		return "", err
+	}
+	// Only the required members, in lexicographic order, take part in the thumbprint.
+	var members any
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return encode(sum[:]), nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+var SymmetricKeyError = errors.New("symmetric keys have no public representation")
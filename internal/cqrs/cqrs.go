@@ -7,3 +7,7 @@ type CommandHandler[TIn any] interface {
 type CommandHandlerWithResponse[TIn any, TOut any] interface {
 	Execute(cmd TIn) (TOut, error)
 }
+
+type QueryHandler[TIn any, TOut any] interface {
+	Execute(query TIn) (TOut, error)
+}
@@ -0,0 +1,62 @@
+package credentials
+
+import (
+	"database/sql"
+	"errors"
+	"sw/internal/identity/crypto"
+	"sw/internal/logging"
+)
+
+type Account struct {
+	ID             string
+	Email          string
+	EmailConfirmed bool
+}
+
+// Verifier checks an email and password pair against the account table.
+type Verifier struct {
+	db     *sql.DB
+	hasher crypto.Hasher
+	logger logging.Logger
+}
+
+func NewVerifier(db *sql.DB, hasher crypto.Hasher, logger logging.Logger) *Verifier {
+	return &Verifier{db: db, hasher: hasher, logger: logger}
+}
+
+func (v *Verifier) Verify(email string, password string) (Account, error) {
+	query := "SELECT id, email, email_confirmed, password_hash FROM account WHERE email = $1"
+	var account Account
+	var passwordHash string
+	err := v.db.QueryRow(query, email).Scan(&account.ID, &account.Email, &account.EmailConfirmed, &passwordHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Account{}, InvalidCredentialsError
+		}
+		return Account{}, err
+	}
+	if !v.hasher.Match(passwordHash, password) {
+		return Account{}, InvalidCredentialsError
+	}
+	if rehasher, ok := v.hasher.(crypto.Rehasher); ok && rehasher.NeedsRehash(passwordHash) {
+		// The sign-in must not fail because of the upgrade, it is attempted again next time.
+		err = v.rehash(account.ID, passwordHash, password)
+		if err != nil {
+			v.logger.Println("An error occurred during password rehash:", err)
+		}
+	}
+	return account, nil
+}
+
+// rehash replaces the hash unless the password has been changed concurrently.
+func (v *Verifier) rehash(accountID string, oldHash string, password string) error {
+	newHash, err := v.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	query := "UPDATE account SET password_hash = $1 WHERE id = $2 AND password_hash = $3"
+	_, err = v.db.Exec(query, newHash, accountID, oldHash)
+	return err
+}
+
+var InvalidCredentialsError = errors.New("invalid credentials")
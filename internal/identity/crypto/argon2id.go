@@ -0,0 +1,129 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strings"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// Bounds of the parameters, whether configured or read from a stored hash. Below them argon2 panics,
+// above them a single sign-in could take the memory or time of the whole process.
+const (
+	maxArgon2idMemoryKiB  = 1 << 20
+	maxArgon2idIterations = 32
+	minArgon2idSaltLength = 8
+	minArgon2idKeyLength  = 16
+	maxArgon2idKeyLength  = 128
+)
+
+type Argon2idParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Argon2idHasher encodes hashes in the PHC string format:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	return &Argon2idHasher{params: params}
+}
+
+// Validate tells whether hashes made with the parameters are within the bounds Match accepts.
+func (p Argon2idParams) Validate() error {
+	if !p.bounded() || p.SaltLength < minArgon2idSaltLength || p.KeyLength < minArgon2idKeyLength {
+		return fmt.Errorf("argon2id parameters out of bounds: m=%d, t=%d, p=%d, salt length %d, key length %d",
+			p.Memory, p.Iterations, p.Parallelism, p.SaltLength, p.KeyLength)
+	}
+	return nil
+}
+
+// bounded checks the parameters which decide the cost of hashing, argon2 needs 8 KiB of memory per lane.
+func (p Argon2idParams) bounded() bool {
+	return p.Iterations >= 1 && p.Iterations <= maxArgon2idIterations &&
+		p.Parallelism >= 1 &&
+		p.Memory >= 8*uint32(p.Parallelism) && p.Memory <= maxArgon2idMemoryKiB &&
+		p.KeyLength <= maxArgon2idKeyLength
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism,
+		h.params.KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) Match(hashedPassword string, currentPassword string) bool {
+	params, salt, key, err := decodeArgon2id(hashedPassword)
+	if err != nil {
+		return false
+	}
+	computed := argon2.IDKey([]byte(currentPassword), salt, params.Iterations, params.Memory, params.Parallelism,
+		params.KeyLength)
+	return subtle.ConstantTimeCompare(computed, key) == 1
+}
+
+func (h Argon2idHasher) Identifies(hashedPassword string) bool {
+	return strings.HasPrefix(hashedPassword, argon2idPrefix)
+}
+
+func (h Argon2idHasher) NeedsRehash(hashedPassword string) bool {
+	params, salt, _, err := decodeArgon2id(hashedPassword)
+	if err != nil {
+		return true
+	}
+	return params.Memory < h.params.Memory ||
+		params.Iterations < h.params.Iterations ||
+		params.Parallelism != h.params.Parallelism ||
+		params.KeyLength < h.params.KeyLength ||
+		uint32(len(salt)) < h.params.SaltLength
+}
+
+func decodeArgon2id(hashedPassword string) (Argon2idParams, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2idParams{}, nil, nil, InvalidHashError
+	}
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return Argon2idParams{}, nil, nil, InvalidHashError
+	}
+	var params Argon2idParams
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return Argon2idParams{}, nil, nil, InvalidHashError
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, InvalidHashError
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2idParams{}, nil, nil, InvalidHashError
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	if !params.bounded() {
+		return Argon2idParams{}, nil, nil, InvalidHashError
+	}
+	return params, salt, key, nil
+}
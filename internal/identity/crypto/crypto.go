@@ -7,18 +7,25 @@ type Hasher interface {
 	Match(hashedPassword string, currentPassword string) bool
 }
 
-type DefaultHasher struct{}
+// Rehasher tells whether a hash was made with an algorithm or parameters which are no longer preferred,
+// so it can be replaced while the password is at hand.
+type Rehasher interface {
+	NeedsRehash(hashedPassword string) bool
+}
 
-func NewDefaultHasher() *DefaultHasher {
-	return &DefaultHasher{}
+// Matcher verifies passwords against the hashes of a single scheme it recognizes by their encoding.
+type Matcher interface {
+	Identifies(hashedPassword string) bool
+	Match(hashedPassword string, currentPassword string) bool
 }
 
-func (h DefaultHasher) Hash(password string) (string, error) {
-	hashedPasswordBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(hashedPasswordBytes), err
+// Algorithm is a hashing scheme new hashes can be made with.
+type Algorithm interface {
+	Hasher
+	Rehasher
+	Identifies(hashedPassword string) bool
 }
 
-func (h DefaultHasher) Match(hashedPassword string, currentPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(currentPassword))
-	return err == nil
+func NewDefaultHasher() *BcryptHasher {
+	return NewBcryptHasher(bcrypt.DefaultCost)
 }
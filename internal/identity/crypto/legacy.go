@@ -0,0 +1,144 @@
+package crypto
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"strconv"
+	"strings"
+)
+
+// The matchers below verify hashes imported from other systems. They never make new hashes,
+// the accounts get rehashed with the preferred algorithm on their first sign-in.
+
+// Bounds of the costs read from a stored hash. The hashes come from elsewhere, above them a single
+// sign-in could take the memory or time of the whole process. Identifies refuses such hashes, so
+// they are not imported either.
+const (
+	maxPBKDF2Iterations  = 5_000_000
+	maxLegacyKeyLength   = 64
+	maxScryptLogN        = 20
+	maxScryptRP          = 64
+	scryptMemoryUnit     = 128
+	maxScryptMemoryBytes = 1 << 30
+)
+
+// PBKDF2SHA256Matcher verifies hashes in the Django format:
+//
+//	pbkdf2_sha256$<iterations>$<salt>$<base64 hash>
+type PBKDF2SHA256Matcher struct{}
+
+func NewPBKDF2SHA256Matcher() *PBKDF2SHA256Matcher {
+	return &PBKDF2SHA256Matcher{}
+}
+
+func (m PBKDF2SHA256Matcher) Identifies(hashedPassword string) bool {
+	_, _, _, err := decodePBKDF2SHA256(hashedPassword)
+	return err == nil
+}
+
+func (m PBKDF2SHA256Matcher) Match(hashedPassword string, currentPassword string) bool {
+	iterations, salt, key, err := decodePBKDF2SHA256(hashedPassword)
+	if err != nil {
+		return false
+	}
+	computed := pbkdf2.Key([]byte(currentPassword), salt, iterations, len(key), sha256.New)
+	return subtle.ConstantTimeCompare(computed, key) == 1
+}
+
+func decodePBKDF2SHA256(hashedPassword string) (int, []byte, []byte, error) {
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2_sha256" {
+		return 0, nil, nil, InvalidHashError
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 || iterations > maxPBKDF2Iterations {
+		return 0, nil, nil, InvalidHashError
+	}
+	key, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 || len(key) > maxLegacyKeyLength {
+		return 0, nil, nil, InvalidHashError
+	}
+	return iterations, []byte(parts[2]), key, nil
+}
+
+// ScryptMatcher verifies hashes in the PHC string format, with N given as its base 2 logarithm:
+//
+//	$scrypt$ln=<log2 N>,r=<r>,p=<p>$<base64 salt>$<base64 hash>
+type ScryptMatcher struct{}
+
+func NewScryptMatcher() *ScryptMatcher {
+	return &ScryptMatcher{}
+}
+
+func (m ScryptMatcher) Identifies(hashedPassword string) bool {
+	_, _, _, _, _, err := decodeScrypt(hashedPassword)
+	return err == nil
+}
+
+func (m ScryptMatcher) Match(hashedPassword string, currentPassword string) bool {
+	ln, r, p, salt, key, err := decodeScrypt(hashedPassword)
+	if err != nil {
+		return false
+	}
+	computed, err := scrypt.Key([]byte(currentPassword), salt, 1<<ln, r, p, len(key))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(computed, key) == 1
+}
+
+func decodeScrypt(hashedPassword string) (int, int, int, []byte, []byte, error) {
+	// "", "scrypt", "ln=...,r=...,p=...", salt, hash
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 5 || parts[0] != "" || parts[1] != "scrypt" {
+		return 0, 0, 0, nil, nil, InvalidHashError
+	}
+	var ln, r, p int
+	_, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &ln, &r, &p)
+	if err != nil || ln < 1 || ln > maxScryptLogN ||
+		r < 1 || r > maxScryptRP || p < 1 || p > maxScryptRP || r*p > maxScryptRP ||
+		scryptMemoryUnit*r<<ln > maxScryptMemoryBytes {
+		return 0, 0, 0, nil, nil, InvalidHashError
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return 0, 0, 0, nil, nil, InvalidHashError
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(key) == 0 || len(key) > maxLegacyKeyLength {
+		return 0, 0, 0, nil, nil, InvalidHashError
+	}
+	return ln, r, p, salt, key, nil
+}
+
+// SaltedSHA1Matcher verifies hashes of sha1(salt + password) in the format:
+//
+//	sha1$<salt>$<hex hash>
+type SaltedSHA1Matcher struct{}
+
+func NewSaltedSHA1Matcher() *SaltedSHA1Matcher {
+	return &SaltedSHA1Matcher{}
+}
+
+func (m SaltedSHA1Matcher) Identifies(hashedPassword string) bool {
+	return strings.HasPrefix(hashedPassword, "sha1$")
+}
+
+func (m SaltedSHA1Matcher) Match(hashedPassword string, currentPassword string) bool {
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 3 {
+		return false
+	}
+	key, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	computed := sha1.Sum([]byte(parts[1] + currentPassword))
+	return subtle.ConstantTimeCompare(computed[:], key) == 1
+}
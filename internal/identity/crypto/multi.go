@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"sw/config"
+)
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// maxBcryptCost keeps a hash within a second or so, every step doubles the time.
+const maxBcryptCost = 16
+
+// MultiHasher hashes with the preferred algorithm and matches hashes made by any of the supported ones,
+// including legacy schemes of imported accounts. Hashes of the others, or of the preferred one with
+// weaker parameters, need a rehash.
+type MultiHasher struct {
+	preferred Algorithm
+	matchers  []Matcher
+}
+
+func NewMultiHasher(preferred Algorithm, others ...Matcher) *MultiHasher {
+	return &MultiHasher{preferred: preferred, matchers: append([]Matcher{preferred}, others...)}
+}
+
+// NewHasher builds the hasher configured for account passwords, peppered when any peppers are configured.
+func NewHasher(opt config.PasswordHashingOptions) (Algorithm, error) {
+	bcryptHasher := NewBcryptHasher(opt.BcryptCost)
+	argon2idParams := Argon2idParams{
+		Memory:      opt.Argon2id.MemoryKiB,
+		Iterations:  opt.Argon2id.Iterations,
+		Parallelism: opt.Argon2id.Parallelism,
+		SaltLength:  opt.Argon2id.SaltLength,
+		KeyLength:   opt.Argon2id.KeyLength,
+	}
+	argon2idHasher := NewArgon2idHasher(argon2idParams)
+	legacy := []Matcher{NewPBKDF2SHA256Matcher(), NewScryptMatcher(), NewSaltedSHA1Matcher()}
+	var hasher *MultiHasher
+	switch opt.Algorithm {
+	case AlgorithmBcrypt:
+		if opt.BcryptCost < bcrypt.MinCost || opt.BcryptCost > maxBcryptCost {
+			return nil, fmt.Errorf("bcrypt cost out of bounds: %d", opt.BcryptCost)
+		}
+		hasher = NewMultiHasher(bcryptHasher, append([]Matcher{argon2idHasher}, legacy...)...)
+	case AlgorithmArgon2id:
+		err := argon2idParams.Validate()
+		if err != nil {
+			return nil, err
+		}
+		hasher = NewMultiHasher(argon2idHasher, append([]Matcher{bcryptHasher}, legacy...)...)
+	default:
+		return nil, fmt.Errorf("unsupported password hashing algorithm: %q", opt.Algorithm)
+	}
+	if len(opt.Peppers) == 0 {
+		return hasher, nil
+	}
+	peppers := make([]Pepper, 0, len(opt.Peppers))
+	for _, p := range opt.Peppers {
+		pepper, err := LoadPepper(p.Version, p.SecretPath)
+		if err != nil {
+			return nil, err
+		}
+		peppers = append(peppers, pepper)
+	}
+	return NewPepperedHasher(hasher, peppers...)
+}
+
+func (h *MultiHasher) Hash(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+func (h *MultiHasher) Match(hashedPassword string, currentPassword string) bool {
+	for _, matcher := range h.matchers {
+		if matcher.Identifies(hashedPassword) {
+			return matcher.Match(hashedPassword, currentPassword)
+		}
+	}
+	return false
+}
+
+// Identifies tells whether the hash is in an encoding of any supported scheme.
+func (h *MultiHasher) Identifies(hashedPassword string) bool {
+	for _, matcher := range h.matchers {
+		if matcher.Identifies(hashedPassword) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *MultiHasher) NeedsRehash(hashedPassword string) bool {
+	return !h.preferred.Identifies(hashedPassword) || h.preferred.NeedsRehash(hashedPassword)
+}
+
+var InvalidHashError = errors.New("hash is malformed")
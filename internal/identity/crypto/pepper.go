@@ -0,0 +1,139 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	pepperPrefix          = "$pepper$v="
+	minPepperSecretLength = 32
+)
+
+// Pepper is a secret mixed into passwords before hashing, identified by its version.
+type Pepper struct {
+	Version int
+	Secret  []byte
+}
+
+// LoadPepper reads the secret of a pepper from a file, ignoring surrounding whitespace.
+func LoadPepper(version int, path string) (Pepper, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Pepper{}, err
+	}
+	secret := bytes.TrimSpace(data)
+	if len(secret) < minPepperSecretLength {
+		return Pepper{}, fmt.Errorf("pepper %d: secret must be at least %d bytes", version, minPepperSecretLength)
+	}
+	return Pepper{Version: version, Secret: secret}, nil
+}
+
+// PepperedHasher hashes the HMAC-SHA256 of the password keyed with the current pepper instead of the
+// password itself, and prefixes the hash with the pepper version:
+//
+//	$pepper$v=2$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+//
+// Hashes without the prefix, made before the pepper was introduced, still match and need a rehash,
+// as do the ones made with an older pepper.
+type PepperedHasher struct {
+	inner   Algorithm
+	current Pepper
+	peppers map[int][]byte
+}
+
+// NewPepperedHasher uses the pepper with the highest version for new hashes.
+func NewPepperedHasher(inner Algorithm, peppers ...Pepper) (*PepperedHasher, error) {
+	if len(peppers) == 0 {
+		return nil, NoPepperError
+	}
+	h := &PepperedHasher{inner: inner, peppers: make(map[int][]byte, len(peppers))}
+	for _, p := range peppers {
+		if p.Version < 1 {
+			return nil, fmt.Errorf("pepper version must be positive: %d", p.Version)
+		}
+		if _, ok := h.peppers[p.Version]; ok {
+			return nil, fmt.Errorf("duplicate pepper version: %d", p.Version)
+		}
+		h.peppers[p.Version] = p.Secret
+		if p.Version > h.current.Version {
+			h.current = p
+		}
+	}
+	return h, nil
+}
+
+func (h *PepperedHasher) Hash(password string) (string, error) {
+	hashedPassword, err := h.inner.Hash(pepper(h.current.Secret, password))
+	if err != nil {
+		return "", err
+	}
+	return pepperPrefix + strconv.Itoa(h.current.Version) + hashedPassword, nil
+}
+
+func (h *PepperedHasher) Match(hashedPassword string, currentPassword string) bool {
+	if !strings.HasPrefix(hashedPassword, pepperPrefix) {
+		return h.inner.Match(hashedPassword, currentPassword)
+	}
+	version, hashedPassword, err := decodePepper(hashedPassword)
+	if err != nil {
+		return false
+	}
+	secret, ok := h.peppers[version]
+	if !ok {
+		return false
+	}
+	return h.inner.Match(hashedPassword, pepper(secret, currentPassword))
+}
+
+func (h *PepperedHasher) Identifies(hashedPassword string) bool {
+	if !strings.HasPrefix(hashedPassword, pepperPrefix) {
+		return h.inner.Identifies(hashedPassword)
+	}
+	version, hashedPassword, err := decodePepper(hashedPassword)
+	if err != nil {
+		return false
+	}
+	_, ok := h.peppers[version]
+	return ok && h.inner.Identifies(hashedPassword)
+}
+
+func (h *PepperedHasher) NeedsRehash(hashedPassword string) bool {
+	version, hashedPassword, err := decodePepper(hashedPassword)
+	if err != nil || version != h.current.Version {
+		return true
+	}
+	return h.inner.NeedsRehash(hashedPassword)
+}
+
+// pepper keeps the input of the inner algorithm short enough for bcrypt whatever the password length.
+func pepper(secret []byte, password string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(password))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func decodePepper(hashedPassword string) (int, string, error) {
+	rest, ok := strings.CutPrefix(hashedPassword, pepperPrefix)
+	if !ok {
+		return 0, "", InvalidHashError
+	}
+	i := strings.IndexByte(rest, '$')
+	if i < 1 {
+		return 0, "", InvalidHashError
+	}
+	version, err := strconv.Atoi(rest[:i])
+	if err != nil {
+		return 0, "", InvalidHashError
+	}
+	return version, rest[i:], nil
+}
+
+var NoPepperError = errors.New("no pepper configured")
@@ -0,0 +1,41 @@
+package emailotp
+
+import (
+	"database/sql"
+	"sw/internal/logging"
+	"time"
+)
+
+type CodesCleaner struct {
+	db       *sql.DB
+	logger   logging.Logger
+	lifetime time.Duration
+}
+
+func NewCodesCleaner(db *sql.DB, logger logging.Logger, lifetime time.Duration) *CodesCleaner {
+	return &CodesCleaner{db: db, logger: logger, lifetime: lifetime}
+}
+
+func (c *CodesCleaner) Clean() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := c.cleanupDatabase()
+			if err != nil {
+				c.logger.Println("An error occurred during email codes cleaning:", err)
+			}
+		}
+	}
+}
+
+// cleanupDatabase keeps the expired codes of locked out accounts until the lockout ends.
+func (c *CodesCleaner) cleanupDatabase() error {
+	now := time.Now().UTC()
+	query := `DELETE FROM email_otp
+				WHERE created_at < $1 AND (locked_until IS NULL OR locked_until < $2)`
+	_, err := c.db.Exec(query, now.Add(-c.lifetime), now)
+	return err
+}
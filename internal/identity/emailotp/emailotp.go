@@ -0,0 +1,124 @@
+package emailotp
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"sw/config"
+	"sw/internal/random"
+	"time"
+)
+
+// Purposes a code is sent for, an account has at most one code for each of them at a time.
+const (
+	PurposeSignIn       = "signin"
+	PurposeConfirmation = "confirmation"
+)
+
+const (
+	codeLength = 6
+	digits     = "0123456789"
+)
+
+// Codes issues and checks the one-time codes sent by email. Six digits are easily guessed, so every
+// wrong code counts against the account and too many of them lock it out for a while.
+type Codes struct {
+	opt config.EmailOTPOptions
+	db  *sql.DB
+}
+
+func NewCodes(opt config.EmailOTPOptions, db *sql.DB) *Codes {
+	return &Codes{opt: opt, db: db}
+}
+
+// Issue replaces the code of the account for the purpose. Wrong attempts carry over to the new code,
+// so asking for another one doesn't put off the lockout, which ends them once it has passed.
+func (c *Codes) Issue(accountID string, purpose string) (string, error) {
+	code := random.Code(codeLength, digits)
+	query := `INSERT INTO email_otp (purpose, code, attempts, created_at, locked_until, account_id)
+				VALUES ($1, $2, 0, $3, NULL, $4)
+				ON CONFLICT (account_id, purpose) DO UPDATE
+				SET code = EXCLUDED.code,
+					created_at = EXCLUDED.created_at,
+					attempts = CASE WHEN email_otp.locked_until IS NULL THEN email_otp.attempts ELSE 0 END,
+					locked_until = NULL
+				WHERE email_otp.locked_until IS NULL OR email_otp.locked_until <= EXCLUDED.created_at`
+	result, err := c.db.Exec(query, purpose, code, time.Now().UTC(), accountID)
+	if err != nil {
+		return "", err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if count == 0 {
+		return "", LockedError
+	}
+	return code, nil
+}
+
+// Verify consumes the code of the account for the purpose when it matches. The wrong code reaching
+// the maximum voids the current one and starts the lockout.
+func (c *Codes) Verify(accountID string, purpose string, code string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT id, code, attempts, created_at, locked_until FROM email_otp
+				WHERE account_id = $1 AND purpose = $2
+				FOR UPDATE`
+	var id int64
+	var expected string
+	var attempts int
+	var createdAt time.Time
+	var lockedUntil sql.NullTime
+	err = tx.QueryRow(query, accountID, purpose).Scan(&id, &expected, &attempts, &createdAt, &lockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return InvalidCodeError
+		}
+		return err
+	}
+	now := time.Now().UTC()
+	if lockedUntil.Valid && lockedUntil.Time.After(now) {
+		return LockedError
+	}
+	if now.Sub(createdAt) > time.Duration(c.opt.CodeLifetimeSeconds)*time.Second {
+		return InvalidCodeError
+	}
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) != 1 {
+		verdict := InvalidCodeError
+		if attempts+1 >= c.opt.MaxAttempts {
+			lockedUntil := now.Add(time.Duration(c.opt.LockoutSeconds) * time.Second)
+			query = "UPDATE email_otp SET code = '', attempts = 0, locked_until = $1 WHERE id = $2"
+			_, err = tx.Exec(query, lockedUntil, id)
+			verdict = LockedError
+		} else {
+			query = "UPDATE email_otp SET attempts = attempts + 1 WHERE id = $1"
+			_, err = tx.Exec(query, id)
+		}
+		if err != nil {
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+		return verdict
+	}
+
+	query = "DELETE FROM email_otp WHERE id = $1"
+	_, err = tx.Exec(query, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+var (
+	InvalidCodeError = errors.New("email code is invalid or expired")
+	LockedError      = errors.New("email codes are locked after too many wrong attempts")
+)
@@ -0,0 +1,48 @@
+package emailchange
+
+import (
+	"database/sql"
+	"github.com/labstack/echo/v4"
+	"sw/internal/cqrs"
+)
+
+type EmailChangeCancellationRequest struct {
+	Token string `json:"token" validate:"required,max=64"`
+}
+
+func NewEmailChangeCancellationHandler(
+	cmdHandler cqrs.CommandHandler[EmailChangeCancellationCommand],
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request EmailChangeCancellationRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		cmd := EmailChangeCancellationCommand{Token: request.Token}
+		return cmdHandler.Execute(cmd)
+	}
+}
+
+type EmailChangeCancellationCommandHandler struct {
+	db *sql.DB
+}
+
+type EmailChangeCancellationCommand struct {
+	Token string
+}
+
+func NewEmailChangeCancellationCommandHandler(db *sql.DB) *EmailChangeCancellationCommandHandler {
+	return &EmailChangeCancellationCommandHandler{db: db}
+}
+
+// Execute drops the pending change. Cancelling one which doesn't exist anymore is not an error.
+func (h *EmailChangeCancellationCommandHandler) Execute(cmd EmailChangeCancellationCommand) error {
+	query := "DELETE FROM email_change_token WHERE cancel_value = $1"
+	_, err := h.db.Exec(query, cmd.Token)
+	return err
+}
@@ -0,0 +1,38 @@
+package emailchange
+
+import (
+	"database/sql"
+	"sw/internal/logging"
+	"time"
+)
+
+type EmailChangesCleaner struct {
+	db     *sql.DB
+	logger logging.Logger
+}
+
+func NewEmailChangesCleaner(db *sql.DB, logger logging.Logger) *EmailChangesCleaner {
+	return &EmailChangesCleaner{db: db, logger: logger}
+}
+
+func (c *EmailChangesCleaner) Clean() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := c.cleanupDatabase()
+			if err != nil {
+				c.logger.Println("An error occurred during email changes cleaning:", err)
+			}
+		}
+	}
+}
+
+func (c *EmailChangesCleaner) cleanupDatabase() error {
+	exp := time.Now().UTC().Add(-tokenLifetime)
+	query := "DELETE FROM email_change_token WHERE created_at < $1"
+	_, err := c.db.Exec(query, exp)
+	return err
+}
@@ -0,0 +1,109 @@
+package emailchange
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"net/http"
+	"sw/internal/apierr"
+	"sw/internal/cqrs"
+	"time"
+)
+
+const (
+	ErrInvalidEmailChange = "ERR_INVALID_EMAIL_CHANGE"
+	ErrEmailTaken         = "ERR_EMAIL_TAKEN"
+)
+
+const uniqueViolation = "23505"
+
+// tokenLifetime matches the one of signup email confirmations.
+const tokenLifetime = 24 * time.Hour
+
+type EmailChangeConfirmationRequest struct {
+	Token string `json:"token" validate:"required,max=64"`
+}
+
+func NewEmailChangeConfirmationHandler(
+	cmdHandler cqrs.CommandHandler[EmailChangeConfirmationCommand],
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request EmailChangeConfirmationRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		cmd := EmailChangeConfirmationCommand{Token: request.Token}
+		err = cmdHandler.Execute(cmd)
+		if err != nil {
+			switch err {
+			case InvalidEmailChangeError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrInvalidEmailChange,
+					Message: "The token is invalid or expired",
+				})
+			case EmailTakenError:
+				return c.JSON(http.StatusConflict, apierr.ErrorResponse{
+					Code:    ErrEmailTaken,
+					Message: "The email address is used by another account",
+				})
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+type EmailChangeConfirmationCommandHandler struct {
+	db *sql.DB
+}
+
+type EmailChangeConfirmationCommand struct {
+	Token string
+}
+
+func NewEmailChangeConfirmationCommandHandler(db *sql.DB) *EmailChangeConfirmationCommandHandler {
+	return &EmailChangeConfirmationCommandHandler{db: db}
+}
+
+// Execute swaps the address. Following the link proves the new address, so it counts as confirmed.
+// The address may have been taken since the request, which the unique constraint catches.
+func (h *EmailChangeConfirmationCommandHandler) Execute(cmd EmailChangeConfirmationCommand) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	exp := time.Now().UTC().Add(-tokenLifetime)
+	query := "DELETE FROM email_change_token WHERE value = $1 AND created_at > $2 RETURNING account_id, new_email"
+	var accountID string
+	var newEmail string
+	err = tx.QueryRow(query, cmd.Token, exp).Scan(&accountID, &newEmail)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return InvalidEmailChangeError
+		}
+		return err
+	}
+	query = "UPDATE account SET email = $1, email_confirmed = true WHERE id = $2"
+	_, err = tx.Exec(query, newEmail, accountID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return EmailTakenError
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+var (
+	InvalidEmailChangeError = errors.New("email change token is invalid or expired")
+	EmailTakenError         = errors.New("email is used by another account")
+)
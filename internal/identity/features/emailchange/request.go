@@ -0,0 +1,149 @@
+package emailchange
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/internal/apierr"
+	"sw/internal/cqrs"
+	"sw/internal/identity/crypto"
+	"sw/internal/identity/mail/emailchange"
+	"sw/internal/mail"
+	"sw/internal/random"
+	"time"
+)
+
+const (
+	ErrInvalidPassword = "ERR_INVALID_PASSWORD"
+)
+
+type EmailChangeRequest struct {
+	Email    string `json:"email" validate:"required,max=320,email,not_exist"`
+	Password string `json:"password" validate:"required,max=1024"`
+}
+
+func NewEmailChangeHandler(cmdHandler cqrs.CommandHandler[EmailChangeCommand]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request EmailChangeRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		claims := c.Get("claims").(jwt.MapClaims)
+		sub, err := claims.GetSubject()
+		if err != nil {
+			return err
+		}
+		cmd := EmailChangeCommand{AccountID: sub, Email: request.Email, Password: request.Password}
+		err = cmdHandler.Execute(cmd)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.NoContent(http.StatusUnauthorized)
+			}
+			if err == InvalidPasswordError {
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrInvalidPassword,
+					Message: "The password is invalid",
+				})
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+type EmailChangeCommandHandler struct {
+	db                  *sql.DB
+	hasher              crypto.Hasher
+	confirmationFactory mail.Factory[emailchange.ConfirmationData]
+	notificationFactory mail.Factory[emailchange.NotificationData]
+	emailer             mail.Emailer
+}
+
+type EmailChangeCommand struct {
+	AccountID string
+	Email     string
+	Password  string
+}
+
+func NewEmailChangeCommandHandler(
+	db *sql.DB,
+	hasher crypto.Hasher,
+	confirmationFactory mail.Factory[emailchange.ConfirmationData],
+	notificationFactory mail.Factory[emailchange.NotificationData],
+	emailer mail.Emailer,
+) *EmailChangeCommandHandler {
+	return &EmailChangeCommandHandler{
+		db:                  db,
+		hasher:              hasher,
+		confirmationFactory: confirmationFactory,
+		notificationFactory: notificationFactory,
+		emailer:             emailer,
+	}
+}
+
+// Execute records the new address as pending. A later request replaces the pending one.
+func (h *EmailChangeCommandHandler) Execute(cmd EmailChangeCommand) error {
+	query := "SELECT email, password_hash FROM account WHERE id = $1"
+	var email string
+	var passwordHash string
+	err := h.db.QueryRow(query, cmd.AccountID).Scan(&email, &passwordHash)
+	if err != nil {
+		return err
+	}
+	if !h.hasher.Match(passwordHash, cmd.Password) {
+		return InvalidPasswordError
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	query = "DELETE FROM email_change_token WHERE account_id = $1"
+	_, err = tx.Exec(query, cmd.AccountID)
+	if err != nil {
+		return err
+	}
+	token := random.Secret(32)
+	cancelToken := random.Secret(32)
+	query = "INSERT INTO email_change_token VALUES (DEFAULT, $1, $2, $3, $4, $5)"
+	_, err = tx.Exec(query, token, cancelToken, cmd.Email, time.Now().UTC(), cmd.AccountID)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	confirmationCtx := mail.Context[emailchange.ConfirmationData]{
+		To:   cmd.Email,
+		Data: emailchange.ConfirmationData{ConfirmationToken: token},
+	}
+	e, err := h.confirmationFactory.Create(confirmationCtx)
+	if err != nil {
+		return err
+	}
+	err = h.emailer.Send(e)
+	if err != nil {
+		return err
+	}
+	notificationCtx := mail.Context[emailchange.NotificationData]{
+		To:   email,
+		Data: emailchange.NotificationData{NewEmail: cmd.Email, CancelToken: cancelToken},
+	}
+	e, err = h.notificationFactory.Create(notificationCtx)
+	if err != nil {
+		return err
+	}
+	return h.emailer.Send(e)
+}
+
+var InvalidPasswordError = errors.New("password is invalid")
@@ -0,0 +1,174 @@
+package me
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/internal/apierr"
+	"sw/internal/cqrs"
+	"sw/internal/identity/crypto"
+	"sw/internal/identity/mail/passwordchanged"
+	"sw/internal/identity/passwordpolicy"
+	"sw/internal/identity/tokens"
+	"sw/internal/logging"
+	"sw/internal/mail"
+)
+
+const (
+	ErrInvalidCurrentPassword = "ERR_INVALID_CURRENT_PASSWORD"
+)
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required,max=1024"`
+	NewPassword     string `json:"new_password" validate:"required,max=1024"`
+	// SignOutOthers revokes every session but the one of RefreshToken, when given.
+	SignOutOthers bool   `json:"sign_out_others"`
+	RefreshToken  string `json:"refresh_token" validate:"max=64"`
+}
+
+func NewChangePasswordHandler(cmdHandler cqrs.CommandHandler[ChangePasswordCommand]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request ChangePasswordRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		claims := c.Get("claims").(jwt.MapClaims)
+		sub, err := claims.GetSubject()
+		if err != nil {
+			return err
+		}
+		cmd := ChangePasswordCommand{
+			AccountID:       sub,
+			CurrentPassword: request.CurrentPassword,
+			NewPassword:     request.NewPassword,
+			SignOutOthers:   request.SignOutOthers,
+			RefreshToken:    request.RefreshToken,
+		}
+		err = cmdHandler.Execute(cmd)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.NoContent(http.StatusUnauthorized)
+			}
+			if err == InvalidCurrentPasswordError {
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrInvalidCurrentPassword,
+					Message: "The current password is invalid",
+				})
+			}
+			var violationErr *passwordpolicy.ViolationError
+			if errors.As(err, &violationErr) {
+				return c.JSON(http.StatusBadRequest, passwordpolicy.MapViolationError("new_password", violationErr))
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+type ChangePasswordCommandHandler struct {
+	db           *sql.DB
+	hasher       crypto.Hasher
+	policy       *passwordpolicy.Policy
+	history      *passwordpolicy.History
+	emailFactory mail.Factory[passwordchanged.Data]
+	emailer      mail.Emailer
+	logger       logging.Logger
+}
+
+type ChangePasswordCommand struct {
+	AccountID       string
+	CurrentPassword string
+	NewPassword     string
+	SignOutOthers   bool
+	RefreshToken    string
+}
+
+func NewChangePasswordCommandHandler(
+	db *sql.DB,
+	hasher crypto.Hasher,
+	policy *passwordpolicy.Policy,
+	history *passwordpolicy.History,
+	emailFactory mail.Factory[passwordchanged.Data],
+	emailer mail.Emailer,
+	logger logging.Logger,
+) *ChangePasswordCommandHandler {
+	return &ChangePasswordCommandHandler{
+		db:           db,
+		hasher:       hasher,
+		policy:       policy,
+		history:      history,
+		emailFactory: emailFactory,
+		emailer:      emailer,
+		logger:       logger,
+	}
+}
+
+func (h *ChangePasswordCommandHandler) Execute(cmd ChangePasswordCommand) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "SELECT email, password_hash FROM account WHERE id = $1 FOR UPDATE"
+	var email string
+	var currentHash string
+	err = tx.QueryRow(query, cmd.AccountID).Scan(&email, &currentHash)
+	if err != nil {
+		return err
+	}
+	if !h.hasher.Match(currentHash, cmd.CurrentPassword) {
+		return InvalidCurrentPasswordError
+	}
+	err = h.policy.Enforce(cmd.NewPassword, email)
+	if err != nil {
+		return err
+	}
+	err = h.history.Check(tx, cmd.AccountID, currentHash, cmd.NewPassword)
+	if err != nil {
+		return err
+	}
+	passwordHash, err := h.hasher.Hash(cmd.NewPassword)
+	if err != nil {
+		return err
+	}
+	query = "UPDATE account SET password_hash = $1 WHERE id = $2"
+	_, err = tx.Exec(query, passwordHash, cmd.AccountID)
+	if err != nil {
+		return err
+	}
+	err = h.history.Record(tx, cmd.AccountID, currentHash)
+	if err != nil {
+		return err
+	}
+	if cmd.SignOutOthers {
+		err = tokens.RevokeOthers(tx, cmd.AccountID, cmd.RefreshToken)
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	// The password is changed by now, failing to tell about it must not report the change as failed.
+	ctx := mail.Context[passwordchanged.Data]{To: email, Data: passwordchanged.Data{}}
+	e, err := h.emailFactory.Create(ctx)
+	if err == nil {
+		err = h.emailer.Send(e)
+	}
+	if err != nil {
+		h.logger.Println("An error occurred during password changed notification:", err)
+	}
+	return nil
+}
+
+var InvalidCurrentPasswordError = errors.New("current password is invalid")
@@ -0,0 +1,105 @@
+package oauth
+
+import (
+	"database/sql"
+	"sw/config"
+	"sw/internal/identity/credentials"
+	"sw/internal/identity/crypto"
+	"sw/internal/identity/tokens"
+	"time"
+)
+
+type AuthorizationCodeCommandHandler struct {
+	opt    config.Config
+	issuer *tokens.Issuer
+	db     *sql.DB
+	hasher crypto.Hasher
+}
+
+type AuthorizationCodeCommand struct {
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	UserAgent    string
+	IP           string
+}
+
+func NewAuthorizationCodeCommandHandler(
+	opt config.Config,
+	issuer *tokens.Issuer,
+	db *sql.DB,
+	hasher crypto.Hasher,
+) *AuthorizationCodeCommandHandler {
+	return &AuthorizationCodeCommandHandler{opt: opt, issuer: issuer, db: db, hasher: hasher}
+}
+
+func (h *AuthorizationCodeCommandHandler) Execute(cmd AuthorizationCodeCommand) (TokenCommandResponse, error) {
+	if cmd.Code == "" || cmd.RedirectURI == "" || cmd.CodeVerifier == "" {
+		return TokenCommandResponse{}, InvalidRequestError
+	}
+	_, err := authenticateClient(h.db, h.hasher, cmd.ClientID, cmd.ClientSecret)
+	if err != nil {
+		return TokenCommandResponse{}, err
+	}
+	// A code is redeemed once, whatever the outcome, so a failed attempt can't be retried
+	// with another verifier.
+	query := `DELETE FROM oauth_authorization_code c
+				USING oauth_client cl, account a
+				WHERE cl.id = c.client_id AND a.id = c.account_id AND c.value = $1
+				RETURNING cl.client_id, c.redirect_uri, c.scope, c.nonce, c.code_challenge, c.created_at,
+					a.id, a.email, a.email_confirmed`
+	var clientID, redirectURI, scope, nonce, codeChallenge string
+	var createdAt time.Time
+	var account credentials.Account
+	err = h.db.QueryRow(query, cmd.Code).Scan(&clientID, &redirectURI, &scope, &nonce, &codeChallenge, &createdAt,
+		&account.ID, &account.Email, &account.EmailConfirmed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return TokenCommandResponse{}, InvalidGrantError
+		}
+		return TokenCommandResponse{}, err
+	}
+
+	lifetime := time.Second * time.Duration(h.opt.OAuth.AuthorizationCodeLifetimeSeconds)
+	if time.Now().UTC().Sub(createdAt) > lifetime ||
+		clientID != cmd.ClientID ||
+		redirectURI != cmd.RedirectURI ||
+		!verifyCodeVerifier(codeChallenge, cmd.CodeVerifier) {
+		return TokenCommandResponse{}, InvalidGrantError
+	}
+
+	accessToken, err := h.issuer.AccessToken(account.ID, account.Email)
+	if err != nil {
+		return TokenCommandResponse{}, err
+	}
+	refreshToken, err := h.issuer.RefreshToken(h.db, account.ID, tokens.Origin{
+		UserAgent: cmd.UserAgent,
+		IP:        cmd.IP,
+		ClientID:  cmd.ClientID,
+	})
+	if err != nil {
+		return TokenCommandResponse{}, err
+	}
+	response := TokenCommandResponse{
+		AccessToken:  accessToken,
+		ExpiresIn:    h.opt.JWT.AccessTokenLifetimeMinutes * 60,
+		RefreshToken: refreshToken,
+		Scope:        scope,
+	}
+	if hasScope(scope, scopeOpenID) {
+		response.IDToken, err = h.issuer.IDToken(tokens.IDToken{
+			Subject:       account.ID,
+			Audience:      clientID,
+			Email:         account.Email,
+			EmailVerified: account.EmailConfirmed,
+			Nonce:         nonce,
+			AuthTime:      createdAt,
+		})
+		if err != nil {
+			return TokenCommandResponse{}, err
+		}
+	}
+	return response, nil
+}
@@ -0,0 +1,259 @@
+package oauth
+
+import (
+	"database/sql"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/url"
+	"sw/internal/apierr"
+	"sw/internal/cqrs"
+	"sw/internal/identity/credentials"
+	"sw/internal/identity/features/signin"
+	"sw/internal/identity/mfa"
+	"sw/internal/random"
+	"time"
+)
+
+type AuthorizationRequest struct {
+	ResponseType        string `query:"response_type" form:"response_type" json:"response_type"`
+	ClientID            string `query:"client_id" form:"client_id" json:"client_id" validate:"required,max=64"`
+	RedirectURI         string `query:"redirect_uri" form:"redirect_uri" json:"redirect_uri" validate:"required,max=2048"`
+	Scope               string `query:"scope" form:"scope" json:"scope" validate:"max=1024"`
+	State               string `query:"state" form:"state" json:"state" validate:"max=1024"`
+	CodeChallenge       string `query:"code_challenge" form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `query:"code_challenge_method" form:"code_challenge_method" json:"code_challenge_method"`
+	Nonce               string `query:"nonce" form:"nonce" json:"nonce" validate:"max=256"`
+}
+
+type AuthorizeRequest struct {
+	AuthorizationRequest
+	Email    string `form:"email" json:"email" validate:"required,max=320,email"`
+	Password string `form:"password" json:"password" validate:"required,max=1024"`
+	// MFACode is required from accounts with a second factor enabled, the login page asks for it
+	// after a first submission fails with ERR_MFA_REQUIRED.
+	MFACode string `form:"mfa_code" json:"mfa_code" validate:"max=16"`
+}
+
+type AuthorizeResponse struct {
+	RedirectURI string `json:"redirect_uri"`
+}
+
+// NewAuthorizationRequestHandler is the entry point of the flow. Once the client and its redirect uri
+// are known to be valid, the user agent is sent to the login page, which submits the credentials
+// along with the original parameters to the authorize handler.
+func NewAuthorizationRequestHandler(
+	loginURL string,
+	queryHandler cqrs.QueryHandler[ClientQuery, Client],
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request AuthorizationRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		client, err := queryHandler.Execute(ClientQuery{ClientID: request.ClientID})
+		if err != nil {
+			if err == InvalidClientError {
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrUnknownClient,
+					Message: "The client is not registered",
+				})
+			}
+			return err
+		}
+		if !client.AllowsRedirectURI(request.RedirectURI) {
+			return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+				Code:    ErrInvalidRedirectURI,
+				Message: "The redirect uri is not registered for the client",
+			})
+		}
+		return c.Redirect(http.StatusFound, loginURL+"?"+c.QueryString())
+	}
+}
+
+// NewAuthorizeHandler authenticates the account and answers with the uri the user agent has to be
+// redirected to, carrying either the authorization code or an error for the client.
+func NewAuthorizeHandler(
+	cmdHandler cqrs.CommandHandlerWithResponse[AuthorizeCommand, AuthorizeCommandResponse],
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request AuthorizeRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		cmd := AuthorizeCommand{
+			ResponseType:        request.ResponseType,
+			ClientID:            request.ClientID,
+			RedirectURI:         request.RedirectURI,
+			Scope:               request.Scope,
+			CodeChallenge:       request.CodeChallenge,
+			CodeChallengeMethod: request.CodeChallengeMethod,
+			Nonce:               request.Nonce,
+			Email:               request.Email,
+			Password:            request.Password,
+			MFACode:             request.MFACode,
+		}
+		cmdResponse, err := cmdHandler.Execute(cmd)
+		if err != nil {
+			switch err {
+			case InvalidClientError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrUnknownClient,
+					Message: "The client is not registered",
+				})
+			case InvalidRedirectURIError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrInvalidRedirectURI,
+					Message: "The redirect uri is not registered for the client",
+				})
+			case credentials.InvalidCredentialsError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    signin.ErrInvalidCredentials,
+					Message: "Credentials are invalid",
+				})
+			case mfa.RequiredError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrMFARequired,
+					Message: "A code of the second factor is required",
+				})
+			case mfa.InvalidCodeError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    signin.ErrInvalidMFACode,
+					Message: "The code is invalid",
+				})
+			case mfa.LockedError:
+				return c.JSON(http.StatusTooManyRequests, apierr.ErrorResponse{
+					Code:    signin.ErrMFALocked,
+					Message: "Too many wrong codes, try again later",
+				})
+			}
+			if _, response, ok := errorResponse(err); ok {
+				params := url.Values{"error": {response.Error}, "error_description": {response.ErrorDescription}}
+				return redirectResponse(c, request.RedirectURI, params, request.State)
+			}
+			return err
+		}
+		return redirectResponse(c, request.RedirectURI, url.Values{"code": {cmdResponse.Code}}, request.State)
+	}
+}
+
+func redirectResponse(c echo.Context, redirectURI string, params url.Values, state string) error {
+	if state != "" {
+		params.Set("state", state)
+	}
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return err
+	}
+	query := u.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+	u.RawQuery = query.Encode()
+	return c.JSON(http.StatusOK, AuthorizeResponse{RedirectURI: u.String()})
+}
+
+type AuthorizeCommandHandler struct {
+	db            *sql.DB
+	verifier      *credentials.Verifier
+	authenticator *mfa.Authenticator
+}
+
+type AuthorizeCommand struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	Email               string
+	Password            string
+	MFACode             string
+}
+
+type AuthorizeCommandResponse struct {
+	Code string
+}
+
+func NewAuthorizeCommandHandler(
+	db *sql.DB,
+	verifier *credentials.Verifier,
+	authenticator *mfa.Authenticator,
+) *AuthorizeCommandHandler {
+	return &AuthorizeCommandHandler{db: db, verifier: verifier, authenticator: authenticator}
+}
+
+func (h *AuthorizeCommandHandler) Execute(cmd AuthorizeCommand) (AuthorizeCommandResponse, error) {
+	client, err := findClient(h.db, cmd.ClientID)
+	if err != nil {
+		return AuthorizeCommandResponse{}, err
+	}
+	if !client.AllowsRedirectURI(cmd.RedirectURI) {
+		return AuthorizeCommandResponse{}, InvalidRedirectURIError
+	}
+	if cmd.ResponseType != "code" {
+		return AuthorizeCommandResponse{}, UnsupportedResponseTypeError
+	}
+	// PKCE is mandatory, and only with S256 since every client is able to compute it.
+	if cmd.CodeChallengeMethod != codeChallengeMethodS256 || !validCodeChallenge(cmd.CodeChallenge) {
+		return AuthorizeCommandResponse{}, InvalidRequestError
+	}
+	scope, err := parseScope(cmd.Scope, supportedScopes)
+	if err != nil {
+		return AuthorizeCommandResponse{}, err
+	}
+	account, err := h.verifier.Verify(cmd.Email, cmd.Password)
+	if err != nil {
+		return AuthorizeCommandResponse{}, err
+	}
+	required, err := h.authenticator.Required(account.ID)
+	if err != nil {
+		return AuthorizeCommandResponse{}, err
+	}
+	if required {
+		if cmd.MFACode == "" {
+			return AuthorizeCommandResponse{}, mfa.RequiredError
+		}
+		err = h.authenticator.Verify(account.ID, cmd.MFACode)
+		if err != nil {
+			return AuthorizeCommandResponse{}, err
+		}
+	}
+
+	code := random.Secret(32)
+	query := `INSERT INTO oauth_authorization_code
+				(value, client_id, account_id, redirect_uri, scope, nonce, code_challenge, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err = h.db.Exec(query, code, client.ID, account.ID, cmd.RedirectURI, scope, cmd.Nonce, cmd.CodeChallenge,
+		time.Now().UTC())
+	if err != nil {
+		return AuthorizeCommandResponse{}, err
+	}
+	return AuthorizeCommandResponse{Code: code}, nil
+}
+
+type ClientQueryHandler struct {
+	db *sql.DB
+}
+
+type ClientQuery struct {
+	ClientID string
+}
+
+func NewClientQueryHandler(db *sql.DB) *ClientQueryHandler {
+	return &ClientQueryHandler{db: db}
+}
+
+func (h *ClientQueryHandler) Execute(query ClientQuery) (Client, error) {
+	return findClient(h.db, query.ClientID)
+}
@@ -0,0 +1,46 @@
+package oauth
+
+import (
+	"database/sql"
+	"sw/internal/logging"
+	"time"
+)
+
+// CodesCleaner deletes expired authorization and device codes.
+type CodesCleaner struct {
+	db       *sql.DB
+	logger   logging.Logger
+	lifetime time.Duration
+}
+
+func NewCodesCleaner(db *sql.DB, logger logging.Logger, lifetime time.Duration) *CodesCleaner {
+	return &CodesCleaner{db: db, logger: logger, lifetime: lifetime}
+}
+
+func (c *CodesCleaner) Clean() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := c.cleanupDatabase()
+			if err != nil {
+				c.logger.Println("An error occurred during codes cleaning:", err)
+			}
+		}
+	}
+}
+
+func (c *CodesCleaner) cleanupDatabase() error {
+	now := time.Now().UTC()
+	query := "DELETE FROM oauth_authorization_code WHERE created_at < $1"
+	_, err := c.db.Exec(query, now.Add(-c.lifetime))
+	if err != nil {
+		return err
+	}
+	// Expired device codes are kept a while, so polling clients get expired_token rather than invalid_grant.
+	query = "DELETE FROM oauth_device_code WHERE expires_at < $1"
+	_, err = c.db.Exec(query, now.Add(-time.Hour))
+	return err
+}
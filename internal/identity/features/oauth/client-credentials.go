@@ -0,0 +1,59 @@
+package oauth
+
+import (
+	"database/sql"
+	"strings"
+	"sw/config"
+	"sw/internal/identity/crypto"
+	"sw/internal/identity/tokens"
+)
+
+type ClientCredentialsCommandHandler struct {
+	opt    config.JwtOptions
+	issuer *tokens.Issuer
+	db     *sql.DB
+	hasher crypto.Hasher
+}
+
+type ClientCredentialsCommand struct {
+	ClientID     string
+	ClientSecret string
+	Scope        string
+}
+
+func NewClientCredentialsCommandHandler(
+	opt config.JwtOptions,
+	issuer *tokens.Issuer,
+	db *sql.DB,
+	hasher crypto.Hasher,
+) *ClientCredentialsCommandHandler {
+	return &ClientCredentialsCommandHandler{opt: opt, issuer: issuer, db: db, hasher: hasher}
+}
+
+// Execute issues an access token to a confidential client. Without a requested scope the client
+// gets every scope it is registered with. No refresh token is issued, the client can always ask again.
+func (h *ClientCredentialsCommandHandler) Execute(cmd ClientCredentialsCommand) (TokenCommandResponse, error) {
+	client, err := authenticateClient(h.db, h.hasher, cmd.ClientID, cmd.ClientSecret)
+	if err != nil {
+		return TokenCommandResponse{}, err
+	}
+	if !client.Confidential() {
+		return TokenCommandResponse{}, UnauthorizedClientError
+	}
+	scope := client.Scopes
+	if cmd.Scope != "" {
+		scope, err = parseScope(cmd.Scope, strings.Fields(client.Scopes))
+		if err != nil {
+			return TokenCommandResponse{}, err
+		}
+	}
+	accessToken, err := h.issuer.ClientAccessToken(client.ClientID, scope)
+	if err != nil {
+		return TokenCommandResponse{}, err
+	}
+	return TokenCommandResponse{
+		AccessToken: accessToken,
+		ExpiresIn:   h.opt.ClientAccessTokenLifetimeMinutes * 60,
+		Scope:       scope,
+	}, nil
+}
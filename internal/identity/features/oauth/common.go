@@ -0,0 +1,200 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sw/internal/identity/crypto"
+)
+
+// Error codes defined by RFC 6749.
+const (
+	ErrInvalidRequest          = "invalid_request"
+	ErrInvalidClient           = "invalid_client"
+	ErrInvalidGrant            = "invalid_grant"
+	ErrUnauthorizedClient      = "unauthorized_client"
+	ErrUnsupportedGrantType    = "unsupported_grant_type"
+	ErrUnsupportedResponseType = "unsupported_response_type"
+	ErrInvalidScope            = "invalid_scope"
+	ErrUnsupportedTokenType    = "unsupported_token_type"
+)
+
+// Error codes defined by RFC 8628.
+const (
+	ErrAuthorizationPending = "authorization_pending"
+	ErrSlowDown             = "slow_down"
+	ErrAccessDenied         = "access_denied"
+	ErrExpiredToken         = "expired_token"
+)
+
+const (
+	ErrUnknownClient      = "ERR_UNKNOWN_CLIENT"
+	ErrInvalidRedirectURI = "ERR_INVALID_REDIRECT_URI"
+	ErrMFARequired        = "ERR_MFA_REQUIRED"
+)
+
+const (
+	codeChallengeMethodS256 = "S256"
+	scopeOpenID             = "openid"
+)
+
+var supportedScopes = []string{scopeOpenID, "email"}
+
+// ErrorResponse is the error body of RFC 6749, section 5.2.
+type ErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func errorResponse(err error) (int, ErrorResponse, bool) {
+	code, ok := errorCodes[err]
+	if !ok {
+		return 0, ErrorResponse{}, false
+	}
+	status := http.StatusBadRequest
+	if code == ErrInvalidClient {
+		status = http.StatusUnauthorized
+	}
+	return status, ErrorResponse{Error: code, ErrorDescription: err.Error()}, true
+}
+
+type Client struct {
+	ID           int64
+	ClientID     string
+	Name         string
+	SecretHash   string
+	Scopes       string
+	RedirectURIs []string
+}
+
+// Confidential clients hold a secret and have to authenticate with it at the token endpoint.
+func (c Client) Confidential() bool {
+	return c.SecretHash != ""
+}
+
+func (c Client) AllowsRedirectURI(uri string) bool {
+	// Redirect URIs are compared as plain strings, as required for clients using PKCE.
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+func findClient(db *sql.DB, clientID string) (Client, error) {
+	query := "SELECT id, client_id, name, secret_hash, scopes FROM oauth_client WHERE client_id = $1"
+	var client Client
+	var secretHash sql.NullString
+	err := db.QueryRow(query, clientID).Scan(&client.ID, &client.ClientID, &client.Name, &secretHash, &client.Scopes)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Client{}, InvalidClientError
+		}
+		return Client{}, err
+	}
+	client.SecretHash = secretHash.String
+
+	query = "SELECT uri FROM oauth_client_redirect_uri WHERE client_id = $1"
+	rows, err := db.Query(query, client.ID)
+	if err != nil {
+		return Client{}, err
+	}
+	defer rows.Close()
+	client.RedirectURIs = make([]string, 0)
+	for rows.Next() {
+		var uri string
+		err = rows.Scan(&uri)
+		if err != nil {
+			return Client{}, err
+		}
+		client.RedirectURIs = append(client.RedirectURIs, uri)
+	}
+	return client, rows.Err()
+}
+
+// authenticateClient finds the client and, for a confidential one, checks the secret. Public clients
+// are only identified.
+func authenticateClient(db *sql.DB, hasher crypto.Hasher, clientID string, secret string) (Client, error) {
+	if clientID == "" {
+		return Client{}, InvalidClientError
+	}
+	client, err := findClient(db, clientID)
+	if err != nil {
+		return Client{}, err
+	}
+	if client.Confidential() && !hasher.Match(client.SecretHash, secret) {
+		return Client{}, InvalidClientError
+	}
+	return client, nil
+}
+
+// parseScope checks the requested scope and returns it normalized to space separated unique values.
+func parseScope(scope string, allowed []string) (string, error) {
+	values := make([]string, 0)
+	for _, value := range strings.Fields(scope) {
+		if !slices.Contains(allowed, value) {
+			return "", InvalidScopeError
+		}
+		if !slices.Contains(values, value) {
+			values = append(values, value)
+		}
+	}
+	return strings.Join(values, " "), nil
+}
+
+func hasScope(scope string, value string) bool {
+	return slices.Contains(strings.Fields(scope), value)
+}
+
+func validCodeChallenge(challenge string) bool {
+	// The challenge is a base64url encoded SHA-256 digest without padding.
+	b, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(b) == sha256.Size
+}
+
+// verifyCodeVerifier checks the verifier against the challenge, see RFC 7636, section 4.6.
+func verifyCodeVerifier(challenge string, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, r := range verifier {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-._~", r)) {
+			return false
+		}
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+var (
+	InvalidRequestError          = errors.New("request is missing a parameter or has an invalid one")
+	InvalidClientError           = errors.New("client is unknown or failed to authenticate")
+	InvalidRedirectURIError      = errors.New("redirect uri is not registered for the client")
+	InvalidGrantError            = errors.New("grant is invalid, expired or was issued to another client")
+	UnauthorizedClientError      = errors.New("client is not allowed to use the grant type")
+	UnsupportedGrantTypeError    = errors.New("grant type is not supported")
+	UnsupportedResponseTypeError = errors.New("response type is not supported")
+	InvalidScopeError            = errors.New("scope is unknown or not allowed for the client")
+	UnsupportedTokenTypeError    = errors.New("token type can't be revoked")
+	AuthorizationPendingError    = errors.New("authorization request is still pending")
+	SlowDownError                = errors.New("polling too often, interval increased")
+	AccessDeniedError            = errors.New("authorization request was denied")
+	ExpiredTokenError            = errors.New("device code has expired")
+)
+
+var errorCodes = map[error]string{
+	InvalidRequestError:          ErrInvalidRequest,
+	InvalidClientError:           ErrInvalidClient,
+	InvalidGrantError:            ErrInvalidGrant,
+	UnauthorizedClientError:      ErrUnauthorizedClient,
+	UnsupportedGrantTypeError:    ErrUnsupportedGrantType,
+	UnsupportedResponseTypeError: ErrUnsupportedResponseType,
+	InvalidScopeError:            ErrInvalidScope,
+	UnsupportedTokenTypeError:    ErrUnsupportedTokenType,
+	AuthorizationPendingError:    ErrAuthorizationPending,
+	SlowDownError:                ErrSlowDown,
+	AccessDeniedError:            ErrAccessDenied,
+	ExpiredTokenError:            ErrExpiredToken,
+}
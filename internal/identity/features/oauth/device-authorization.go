@@ -0,0 +1,134 @@
+package oauth
+
+import (
+	"database/sql"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/url"
+	"strings"
+	"sw/config"
+	"sw/internal/cqrs"
+	"sw/internal/identity/crypto"
+	"sw/internal/random"
+	"time"
+)
+
+const (
+	deviceStatusPending  = "pending"
+	deviceStatusApproved = "approved"
+	deviceStatusDenied   = "denied"
+)
+
+// Consonants only, so codes are hard to mistype and don't spell words, see RFC 8628, section 6.1.
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+const userCodeLength = 8
+
+type DeviceAuthorizationRequest struct {
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	Scope        string `form:"scope"`
+}
+
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+func NewDeviceAuthorizationHandler(
+	opt config.OAuthOptions,
+	cmdHandler cqrs.CommandHandlerWithResponse[DeviceAuthorizationCommand, DeviceAuthorizationCommandResponse],
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request DeviceAuthorizationRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		c.Response().Header().Set("Cache-Control", "no-store")
+		clientID, clientSecret := clientCredentials(c, request.ClientID, request.ClientSecret)
+		cmd := DeviceAuthorizationCommand{ClientID: clientID, ClientSecret: clientSecret, Scope: request.Scope}
+		cmdResponse, err := cmdHandler.Execute(cmd)
+		if err != nil {
+			if status, response, ok := errorResponse(err); ok {
+				return c.JSON(status, response)
+			}
+			return err
+		}
+		userCode := formatUserCode(cmdResponse.UserCode)
+		response := DeviceAuthorizationResponse{
+			DeviceCode:              cmdResponse.DeviceCode,
+			UserCode:                userCode,
+			VerificationURI:         opt.DeviceVerificationURL,
+			VerificationURIComplete: opt.DeviceVerificationURL + "?" + url.Values{"user_code": {userCode}}.Encode(),
+			ExpiresIn:               opt.DeviceCodeLifetimeSeconds,
+			Interval:                opt.DevicePollingIntervalSeconds,
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+}
+
+type DeviceAuthorizationCommandHandler struct {
+	opt    config.OAuthOptions
+	db     *sql.DB
+	hasher crypto.Hasher
+}
+
+type DeviceAuthorizationCommand struct {
+	ClientID     string
+	ClientSecret string
+	Scope        string
+}
+
+type DeviceAuthorizationCommandResponse struct {
+	DeviceCode string
+	UserCode   string
+}
+
+func NewDeviceAuthorizationCommandHandler(
+	opt config.OAuthOptions,
+	db *sql.DB,
+	hasher crypto.Hasher,
+) *DeviceAuthorizationCommandHandler {
+	return &DeviceAuthorizationCommandHandler{opt: opt, db: db, hasher: hasher}
+}
+
+func (h *DeviceAuthorizationCommandHandler) Execute(
+	cmd DeviceAuthorizationCommand,
+) (DeviceAuthorizationCommandResponse, error) {
+	client, err := authenticateClient(h.db, h.hasher, cmd.ClientID, cmd.ClientSecret)
+	if err != nil {
+		return DeviceAuthorizationCommandResponse{}, err
+	}
+	scope, err := parseScope(cmd.Scope, supportedScopes)
+	if err != nil {
+		return DeviceAuthorizationCommandResponse{}, err
+	}
+	deviceCode := random.Secret(32)
+	userCode := random.Code(userCodeLength, userCodeAlphabet)
+	expiresAt := time.Now().UTC().Add(time.Second * time.Duration(h.opt.DeviceCodeLifetimeSeconds))
+	query := `INSERT INTO oauth_device_code
+				(device_code, user_code, client_id, scope, status, interval_seconds, expires_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err = h.db.Exec(query, deviceCode, userCode, client.ID, scope, deviceStatusPending,
+		h.opt.DevicePollingIntervalSeconds, expiresAt)
+	if err != nil {
+		return DeviceAuthorizationCommandResponse{}, err
+	}
+	return DeviceAuthorizationCommandResponse{DeviceCode: deviceCode, UserCode: userCode}, nil
+}
+
+// formatUserCode splits the code in two halves for readability, like WDJB-MJHT.
+func formatUserCode(code string) string {
+	return code[:len(code)/2] + "-" + code[len(code)/2:]
+}
+
+// normalizeUserCode accepts what people type: any case, with or without the separator.
+func normalizeUserCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,155 @@
+package oauth
+
+import (
+	"database/sql"
+	"sw/config"
+	"sw/internal/identity/credentials"
+	"sw/internal/identity/crypto"
+	"sw/internal/identity/tokens"
+	"time"
+)
+
+// slowDownIncrement is added to the polling interval of a client which polls too often, see RFC 8628, section 3.5.
+const slowDownIncrement = 5
+
+type DeviceCodeCommandHandler struct {
+	opt    config.Config
+	issuer *tokens.Issuer
+	db     *sql.DB
+	hasher crypto.Hasher
+}
+
+type DeviceCodeCommand struct {
+	ClientID     string
+	ClientSecret string
+	DeviceCode   string
+	UserAgent    string
+	IP           string
+}
+
+func NewDeviceCodeCommandHandler(
+	opt config.Config,
+	issuer *tokens.Issuer,
+	db *sql.DB,
+	hasher crypto.Hasher,
+) *DeviceCodeCommandHandler {
+	return &DeviceCodeCommandHandler{opt: opt, issuer: issuer, db: db, hasher: hasher}
+}
+
+func (h *DeviceCodeCommandHandler) Execute(cmd DeviceCodeCommand) (TokenCommandResponse, error) {
+	if cmd.DeviceCode == "" {
+		return TokenCommandResponse{}, InvalidRequestError
+	}
+	client, err := authenticateClient(h.db, h.hasher, cmd.ClientID, cmd.ClientSecret)
+	if err != nil {
+		return TokenCommandResponse{}, err
+	}
+	tx, err := h.db.Begin()
+	if err != nil {
+		return TokenCommandResponse{}, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT id, client_id, scope, status, account_id, approved_at, interval_seconds, last_polled_at, expires_at
+				FROM oauth_device_code
+				WHERE device_code = $1
+				FOR UPDATE`
+	var id, clientID int64
+	var scope, status string
+	var accountID sql.NullString
+	var approvedAt, lastPolledAt sql.NullTime
+	var interval int
+	var expiresAt time.Time
+	err = tx.QueryRow(query, cmd.DeviceCode).
+		Scan(&id, &clientID, &scope, &status, &accountID, &approvedAt, &interval, &lastPolledAt, &expiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return TokenCommandResponse{}, InvalidGrantError
+		}
+		return TokenCommandResponse{}, err
+	}
+	if clientID != client.ID {
+		return TokenCommandResponse{}, InvalidGrantError
+	}
+	now := time.Now().UTC()
+	if !expiresAt.After(now) {
+		return TokenCommandResponse{}, ExpiredTokenError
+	}
+
+	switch status {
+	case deviceStatusDenied:
+		return TokenCommandResponse{}, h.finish(tx, id, AccessDeniedError)
+	case deviceStatusPending:
+		pollErr := AuthorizationPendingError
+		if lastPolledAt.Valid && now.Sub(lastPolledAt.Time) < time.Second*time.Duration(interval) {
+			pollErr = SlowDownError
+			interval += slowDownIncrement
+		}
+		query = "UPDATE oauth_device_code SET last_polled_at = $1, interval_seconds = $2 WHERE id = $3"
+		_, err = tx.Exec(query, now, interval, id)
+		if err != nil {
+			return TokenCommandResponse{}, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return TokenCommandResponse{}, err
+		}
+		return TokenCommandResponse{}, pollErr
+	}
+
+	query = "SELECT id, email, email_confirmed FROM account WHERE id = $1"
+	var account credentials.Account
+	err = tx.QueryRow(query, accountID.String).Scan(&account.ID, &account.Email, &account.EmailConfirmed)
+	if err != nil {
+		return TokenCommandResponse{}, err
+	}
+	accessToken, err := h.issuer.AccessToken(account.ID, account.Email)
+	if err != nil {
+		return TokenCommandResponse{}, err
+	}
+	refreshToken, err := h.issuer.RefreshToken(tx, account.ID, tokens.Origin{
+		UserAgent: cmd.UserAgent,
+		IP:        cmd.IP,
+		ClientID:  client.ClientID,
+	})
+	if err != nil {
+		return TokenCommandResponse{}, err
+	}
+	response := TokenCommandResponse{
+		AccessToken:  accessToken,
+		ExpiresIn:    h.opt.JWT.AccessTokenLifetimeMinutes * 60,
+		RefreshToken: refreshToken,
+		Scope:        scope,
+	}
+	if hasScope(scope, scopeOpenID) {
+		response.IDToken, err = h.issuer.IDToken(tokens.IDToken{
+			Subject:       account.ID,
+			Audience:      client.ClientID,
+			Email:         account.Email,
+			EmailVerified: account.EmailConfirmed,
+			AuthTime:      approvedAt.Time,
+		})
+		if err != nil {
+			return TokenCommandResponse{}, err
+		}
+	}
+	err = h.finish(tx, id, nil)
+	if err != nil {
+		return TokenCommandResponse{}, err
+	}
+	return response, nil
+}
+
+// finish deletes the device code once the outcome has been delivered to the client.
+func (h *DeviceCodeCommandHandler) finish(tx *sql.Tx, id int64, result error) error {
+	query := "DELETE FROM oauth_device_code WHERE id = $1"
+	_, err := tx.Exec(query, id)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return result
+}
@@ -0,0 +1,158 @@
+package oauth
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/internal/apierr"
+	"sw/internal/cqrs"
+	"time"
+)
+
+const (
+	ErrInvalidUserCode = "ERR_INVALID_USER_CODE"
+)
+
+type DeviceRequestQuery struct {
+	UserCode string `query:"user_code" validate:"required,max=16"`
+}
+
+type DeviceRequestResponse struct {
+	ClientName string `json:"client_name"`
+	Scope      string `json:"scope"`
+}
+
+// NewDeviceRequestHandler describes the pending request behind a user code, so the account can see
+// which client it is about to let in.
+func NewDeviceRequestHandler(queryHandler cqrs.QueryHandler[DeviceRequestQuery, DeviceRequest]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request DeviceRequestQuery
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		deviceRequest, err := queryHandler.Execute(request)
+		if err != nil {
+			if err == InvalidUserCodeError {
+				return invalidUserCodeResponse(c)
+			}
+			return err
+		}
+		response := DeviceRequestResponse{ClientName: deviceRequest.ClientName, Scope: deviceRequest.Scope}
+		return c.JSON(http.StatusOK, response)
+	}
+}
+
+type DeviceRequestQueryHandler struct {
+	db *sql.DB
+}
+
+type DeviceRequest struct {
+	ClientName string
+	Scope      string
+}
+
+func NewDeviceRequestQueryHandler(db *sql.DB) *DeviceRequestQueryHandler {
+	return &DeviceRequestQueryHandler{db: db}
+}
+
+func (h *DeviceRequestQueryHandler) Execute(query DeviceRequestQuery) (DeviceRequest, error) {
+	sqlQuery := `SELECT cl.name, d.scope FROM oauth_device_code d
+				JOIN oauth_client cl ON cl.id = d.client_id
+				WHERE d.user_code = $1 AND d.status = $2 AND d.expires_at > $3`
+	var deviceRequest DeviceRequest
+	err := h.db.QueryRow(sqlQuery, normalizeUserCode(query.UserCode), deviceStatusPending, time.Now().UTC()).
+		Scan(&deviceRequest.ClientName, &deviceRequest.Scope)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return DeviceRequest{}, InvalidUserCodeError
+		}
+		return DeviceRequest{}, err
+	}
+	return deviceRequest, nil
+}
+
+type DeviceVerificationRequest struct {
+	UserCode string `json:"user_code" validate:"required,max=16"`
+	Approve  bool   `json:"approve"`
+}
+
+func NewDeviceVerificationHandler(cmdHandler cqrs.CommandHandler[DeviceVerificationCommand]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request DeviceVerificationRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		claims := c.Get("claims").(jwt.MapClaims)
+		sub, err := claims.GetSubject()
+		if err != nil {
+			return err
+		}
+		cmd := DeviceVerificationCommand{AccountID: sub, UserCode: request.UserCode, Approve: request.Approve}
+		err = cmdHandler.Execute(cmd)
+		if err != nil {
+			if err == InvalidUserCodeError {
+				return invalidUserCodeResponse(c)
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+type DeviceVerificationCommandHandler struct {
+	db *sql.DB
+}
+
+type DeviceVerificationCommand struct {
+	AccountID string
+	UserCode  string
+	Approve   bool
+}
+
+func NewDeviceVerificationCommandHandler(db *sql.DB) *DeviceVerificationCommandHandler {
+	return &DeviceVerificationCommandHandler{db: db}
+}
+
+// Execute approves or denies a pending request. Either way the user code is used up.
+func (h *DeviceVerificationCommandHandler) Execute(cmd DeviceVerificationCommand) error {
+	status := deviceStatusDenied
+	if cmd.Approve {
+		status = deviceStatusApproved
+	}
+	now := time.Now().UTC()
+	query := `UPDATE oauth_device_code SET status = $1, account_id = $2, approved_at = $3
+				WHERE user_code = $4 AND status = $5 AND expires_at > $3`
+	result, err := h.db.Exec(query, status, cmd.AccountID, now, normalizeUserCode(cmd.UserCode), deviceStatusPending)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return InvalidUserCodeError
+	}
+	return nil
+}
+
+func invalidUserCodeResponse(c echo.Context) error {
+	return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+		Code:    ErrInvalidUserCode,
+		Message: "The code is invalid or expired",
+	})
+}
+
+var InvalidUserCodeError = errors.New("user code is invalid or expired")
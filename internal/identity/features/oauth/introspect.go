@@ -0,0 +1,153 @@
+package oauth
+
+import (
+	"database/sql"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+	"sw/config"
+	"sw/internal/auth"
+	"sw/internal/auth/keys"
+	"sw/internal/cqrs"
+	"sw/internal/identity/crypto"
+	"time"
+)
+
+const (
+	tokenTypeAccessToken  = "access_token"
+	tokenTypeRefreshToken = "refresh_token"
+)
+
+type IntrospectionRequest struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// IntrospectionResponse follows RFC 7662, section 2.2. An inactive token has nothing but active set.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	TokenType string `json:"token_type,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+func NewIntrospectionHandler(queryHandler cqrs.QueryHandler[IntrospectionQuery, Introspection]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request IntrospectionRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		clientID, clientSecret := clientCredentials(c, request.ClientID, request.ClientSecret)
+		query := IntrospectionQuery{ClientID: clientID, ClientSecret: clientSecret, Token: request.Token}
+		introspection, err := queryHandler.Execute(query)
+		if err != nil {
+			if status, response, ok := errorResponse(err); ok {
+				if status == http.StatusUnauthorized {
+					c.Response().Header().Set("WWW-Authenticate", `Basic realm="introspect"`)
+				}
+				return c.JSON(status, response)
+			}
+			return err
+		}
+		response := IntrospectionResponse{Active: introspection.Active}
+		if introspection.Active {
+			response.TokenType = introspection.TokenType
+			response.Subject = introspection.Subject
+			response.ClientID = introspection.ClientID
+			response.Scope = introspection.Scope
+			response.ExpiresAt = introspection.ExpiresAt.Unix()
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+}
+
+type IntrospectionQueryHandler struct {
+	opt     config.JwtOptions
+	keyRing *keys.KeyRing
+	db      *sql.DB
+	hasher  crypto.Hasher
+}
+
+type IntrospectionQuery struct {
+	ClientID     string
+	ClientSecret string
+	Token        string
+}
+
+type Introspection struct {
+	Active    bool
+	TokenType string
+	Subject   string
+	ClientID  string
+	Scope     string
+	ExpiresAt time.Time
+}
+
+func NewIntrospectionQueryHandler(
+	opt config.JwtOptions,
+	keyRing *keys.KeyRing,
+	db *sql.DB,
+	hasher crypto.Hasher,
+) *IntrospectionQueryHandler {
+	return &IntrospectionQueryHandler{opt: opt, keyRing: keyRing, db: db, hasher: hasher}
+}
+
+// Execute is available to confidential clients only, resource servers asking about the tokens
+// presented to them.
+func (h *IntrospectionQueryHandler) Execute(query IntrospectionQuery) (Introspection, error) {
+	client, err := authenticateClient(h.db, h.hasher, query.ClientID, query.ClientSecret)
+	if err != nil {
+		return Introspection{}, err
+	}
+	if !client.Confidential() {
+		return Introspection{}, InvalidClientError
+	}
+	if query.Token == "" {
+		return Introspection{}, InvalidRequestError
+	}
+	if isJWT(query.Token) {
+		return h.introspectAccessToken(query.Token)
+	}
+	return h.introspectRefreshToken(query.Token)
+}
+
+// introspectAccessToken reports access tokens for the audience only, an ID token is no credential.
+func (h *IntrospectionQueryHandler) introspectAccessToken(token string) (Introspection, error) {
+	claims, err := auth.ParseAccessToken(h.keyRing, h.opt.Audience, token)
+	if err != nil {
+		return Introspection{Active: false}, nil
+	}
+	introspection := Introspection{Active: true, TokenType: tokenTypeAccessToken}
+	introspection.Subject, _ = claims.GetSubject()
+	introspection.ClientID, _ = claims["client_id"].(string)
+	introspection.Scope, _ = claims["scope"].(string)
+	exp, err := claims.GetExpirationTime()
+	if err == nil && exp != nil {
+		introspection.ExpiresAt = exp.Time
+	}
+	return introspection, nil
+}
+
+func (h *IntrospectionQueryHandler) introspectRefreshToken(token string) (Introspection, error) {
+	query := `SELECT account_id, expires_at FROM refresh_token
+				WHERE value = $1 AND rotated_at IS NULL AND revoked_at IS NULL AND expires_at > $2`
+	introspection := Introspection{Active: true, TokenType: tokenTypeRefreshToken}
+	err := h.db.QueryRow(query, token, time.Now().UTC()).Scan(&introspection.Subject, &introspection.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Introspection{Active: false}, nil
+		}
+		return Introspection{}, err
+	}
+	return introspection, nil
+}
+
+// isJWT tells access tokens from refresh tokens, which are opaque strings of letters.
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
@@ -0,0 +1,82 @@
+package oauth
+
+import (
+	"database/sql"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/internal/cqrs"
+	"sw/internal/identity/crypto"
+	"sw/internal/identity/tokens"
+)
+
+type RevocationRequest struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+func NewRevocationHandler(cmdHandler cqrs.CommandHandler[RevocationCommand]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request RevocationRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		clientID, clientSecret := clientCredentials(c, request.ClientID, request.ClientSecret)
+		cmd := RevocationCommand{ClientID: clientID, ClientSecret: clientSecret, Token: request.Token}
+		err = cmdHandler.Execute(cmd)
+		if err != nil {
+			if status, response, ok := errorResponse(err); ok {
+				if status == http.StatusUnauthorized {
+					c.Response().Header().Set("WWW-Authenticate", `Basic realm="revoke"`)
+				}
+				return c.JSON(status, response)
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+type RevocationCommandHandler struct {
+	db     *sql.DB
+	hasher crypto.Hasher
+}
+
+type RevocationCommand struct {
+	ClientID     string
+	ClientSecret string
+	Token        string
+}
+
+func NewRevocationCommandHandler(db *sql.DB, hasher crypto.Hasher) *RevocationCommandHandler {
+	return &RevocationCommandHandler{db: db, hasher: hasher}
+}
+
+// Execute revokes the family of a refresh token, ending the session like a sign-out does. Access tokens
+// are self-contained and stay valid until they expire, so their revocation is reported as unsupported.
+// Unknown tokens are not an error, see RFC 7009, section 2.2, and neither are tokens issued to another
+// client, which are treated as unknown, see section 2.1.
+func (h *RevocationCommandHandler) Execute(cmd RevocationCommand) error {
+	client, err := authenticateClient(h.db, h.hasher, cmd.ClientID, cmd.ClientSecret)
+	if err != nil {
+		return err
+	}
+	if cmd.Token == "" {
+		return InvalidRequestError
+	}
+	if isJWT(cmd.Token) {
+		return UnsupportedTokenTypeError
+	}
+	query := "SELECT family FROM refresh_token WHERE value = $1 AND client_id = $2"
+	var family string
+	err = h.db.QueryRow(query, cmd.Token, client.ClientID).Scan(&family)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	return tokens.RevokeFamily(h.db, family)
+}
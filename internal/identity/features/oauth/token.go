@@ -0,0 +1,126 @@
+package oauth
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/url"
+	"sw/internal/cqrs"
+)
+
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	Scope        string `form:"scope"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	DeviceCode   string `form:"device_code"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type TokenCommandResponse struct {
+	AccessToken  string
+	ExpiresIn    int
+	RefreshToken string
+	IDToken      string
+	Scope        string
+}
+
+// NewTokenHandler dispatches the token request to the handler of its grant type. Parameters are
+// checked by the grant handlers, so that failures are reported in the format of RFC 6749.
+func NewTokenHandler(
+	authorizationCodeCmdHandler cqrs.CommandHandlerWithResponse[AuthorizationCodeCommand, TokenCommandResponse],
+	clientCredentialsCmdHandler cqrs.CommandHandlerWithResponse[ClientCredentialsCommand, TokenCommandResponse],
+	deviceCodeCmdHandler cqrs.CommandHandlerWithResponse[DeviceCodeCommand, TokenCommandResponse],
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request TokenRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		c.Response().Header().Set("Cache-Control", "no-store")
+		clientID, clientSecret := clientCredentials(c, request.ClientID, request.ClientSecret)
+
+		var cmdResponse TokenCommandResponse
+		switch request.GrantType {
+		case GrantTypeAuthorizationCode:
+			cmd := AuthorizationCodeCommand{
+				ClientID:     clientID,
+				ClientSecret: clientSecret,
+				Code:         request.Code,
+				RedirectURI:  request.RedirectURI,
+				CodeVerifier: request.CodeVerifier,
+				UserAgent:    c.Request().UserAgent(),
+				IP:           c.RealIP(),
+			}
+			cmdResponse, err = authorizationCodeCmdHandler.Execute(cmd)
+		case GrantTypeClientCredentials:
+			cmd := ClientCredentialsCommand{ClientID: clientID, ClientSecret: clientSecret, Scope: request.Scope}
+			cmdResponse, err = clientCredentialsCmdHandler.Execute(cmd)
+		case GrantTypeDeviceCode:
+			cmd := DeviceCodeCommand{
+				ClientID:     clientID,
+				ClientSecret: clientSecret,
+				DeviceCode:   request.DeviceCode,
+				UserAgent:    c.Request().UserAgent(),
+				IP:           c.RealIP(),
+			}
+			cmdResponse, err = deviceCodeCmdHandler.Execute(cmd)
+		default:
+			err = UnsupportedGrantTypeError
+		}
+		if err != nil {
+			if status, response, ok := errorResponse(err); ok {
+				if status == http.StatusUnauthorized {
+					c.Response().Header().Set("WWW-Authenticate", `Basic realm="token"`)
+				}
+				return c.JSON(status, response)
+			}
+			return err
+		}
+		response := TokenResponse{
+			AccessToken:  cmdResponse.AccessToken,
+			TokenType:    "Bearer",
+			ExpiresIn:    cmdResponse.ExpiresIn,
+			RefreshToken: cmdResponse.RefreshToken,
+			IDToken:      cmdResponse.IDToken,
+			Scope:        cmdResponse.Scope,
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+}
+
+// clientCredentials takes the client credentials from HTTP Basic authentication, falling back to the
+// request body. Basic credentials are form encoded before being put in the header, see RFC 6749, section 2.3.1.
+// Malformed ones result in an empty client id, which fails authentication.
+func clientCredentials(c echo.Context, clientID string, clientSecret string) (string, string) {
+	username, password, ok := c.Request().BasicAuth()
+	if !ok {
+		return clientID, clientSecret
+	}
+	username, err := url.QueryUnescape(username)
+	if err != nil {
+		return "", ""
+	}
+	password, err = url.QueryUnescape(password)
+	if err != nil {
+		return "", ""
+	}
+	return username, password
+}
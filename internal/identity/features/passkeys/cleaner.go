@@ -0,0 +1,39 @@
+package passkeys
+
+import (
+	"database/sql"
+	"sw/internal/logging"
+	"time"
+)
+
+type ChallengesCleaner struct {
+	db       *sql.DB
+	logger   logging.Logger
+	lifetime time.Duration
+}
+
+func NewChallengesCleaner(db *sql.DB, logger logging.Logger, lifetime time.Duration) *ChallengesCleaner {
+	return &ChallengesCleaner{db: db, logger: logger, lifetime: lifetime}
+}
+
+func (c *ChallengesCleaner) Clean() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := c.cleanupDatabase()
+			if err != nil {
+				c.logger.Println("An error occurred during webauthn challenges cleaning:", err)
+			}
+		}
+	}
+}
+
+func (c *ChallengesCleaner) cleanupDatabase() error {
+	exp := time.Now().UTC().Add(-c.lifetime)
+	query := "DELETE FROM webauthn_challenge WHERE created_at < $1"
+	_, err := c.db.Exec(query, exp)
+	return err
+}
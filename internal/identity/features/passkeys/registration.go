@@ -0,0 +1,395 @@
+package passkeys
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/config"
+	"sw/internal/apierr"
+	"sw/internal/cqrs"
+	"sw/internal/identity/crypto"
+	"sw/internal/identity/mail/passkeyadded"
+	"sw/internal/identity/mfa"
+	"sw/internal/identity/webauthn"
+	"sw/internal/mail"
+	"time"
+)
+
+const (
+	ErrInvalidWebAuthnChallenge = "ERR_INVALID_WEBAUTHN_CHALLENGE"
+	ErrInvalidWebAuthnResponse  = "ERR_INVALID_WEBAUTHN_RESPONSE"
+	ErrPasskeyAlreadyRegistered = "ERR_PASSKEY_ALREADY_REGISTERED"
+	ErrInvalidPassword          = "ERR_INVALID_PASSWORD"
+	ErrMFARequired              = "ERR_MFA_REQUIRED"
+	ErrInvalidMFACode           = "ERR_INVALID_MFA_CODE"
+	ErrMFALocked                = "ERR_MFA_LOCKED"
+)
+
+// RegistrationOptionsRequest asks for the password, and the second factor when enabled, as a passkey
+// signs in on its own and must not be added by whoever merely holds an access token.
+type RegistrationOptionsRequest struct {
+	Password string `json:"password" validate:"required,max=1024"`
+	MFACode  string `json:"mfa_code" validate:"max=16"`
+}
+
+// RegistrationOptionsResponse is the PublicKeyCredentialCreationOptionsJSON of WebAuthn Level 3,
+// its member names are kept as browsers parse them with PublicKeyCredential.parseCreationOptionsFromJSON.
+type RegistrationOptionsResponse struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingParty           `json:"rp"`
+	User                   User                   `json:"user"`
+	PubKeyCredParams       []CredentialParameters `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+type RelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type User struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameters struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// NewRegistrationOptionsHandler starts adding a passkey to the signed in account. The passkey is
+// discoverable, so signing in with it takes no email, and verifies the user, so it takes no password.
+// Adding one takes the password and the second factor, anything less would be a way around them.
+func NewRegistrationOptionsHandler(
+	opt config.WebAuthnOptions,
+	cmdHandler cqrs.CommandHandlerWithResponse[RegistrationOptionsCommand, RegistrationOptionsCommandResponse],
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request RegistrationOptionsRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		claims := c.Get("claims").(jwt.MapClaims)
+		sub, err := claims.GetSubject()
+		if err != nil {
+			return err
+		}
+		cmd := RegistrationOptionsCommand{AccountID: sub, Password: request.Password, MFACode: request.MFACode}
+		cmdResponse, err := cmdHandler.Execute(cmd)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return c.NoContent(http.StatusUnauthorized)
+			case InvalidPasswordError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrInvalidPassword,
+					Message: "The password is invalid",
+				})
+			case mfa.RequiredError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrMFARequired,
+					Message: "A code of the second factor is required",
+				})
+			case mfa.InvalidCodeError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrInvalidMFACode,
+					Message: "The code is invalid",
+				})
+			case mfa.LockedError:
+				return c.JSON(http.StatusTooManyRequests, apierr.ErrorResponse{
+					Code:    ErrMFALocked,
+					Message: "Too many wrong codes, try again later",
+				})
+			}
+			return err
+		}
+		params := make([]CredentialParameters, 0, len(webauthn.SupportedAlgorithms))
+		for _, alg := range webauthn.SupportedAlgorithms {
+			params = append(params, CredentialParameters{Type: "public-key", Alg: alg})
+		}
+		exclude := make([]CredentialDescriptor, 0, len(cmdResponse.CredentialIDs))
+		for _, id := range cmdResponse.CredentialIDs {
+			exclude = append(exclude, CredentialDescriptor{
+				Type: "public-key",
+				ID:   base64.RawURLEncoding.EncodeToString(id),
+			})
+		}
+		response := RegistrationOptionsResponse{
+			Challenge: cmdResponse.Challenge,
+			RP:        RelyingParty{ID: opt.RPID, Name: opt.RPName},
+			User: User{
+				ID:          base64.RawURLEncoding.EncodeToString([]byte(sub)),
+				Name:        cmdResponse.Email,
+				DisplayName: cmdResponse.Email,
+			},
+			PubKeyCredParams:   params,
+			Timeout:            opt.ChallengeLifetimeSeconds * 1000,
+			ExcludeCredentials: exclude,
+			AuthenticatorSelection: AuthenticatorSelection{
+				ResidentKey:      "required",
+				UserVerification: "required",
+			},
+			Attestation: "none",
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+}
+
+type RegistrationOptionsCommandHandler struct {
+	db            *sql.DB
+	hasher        crypto.Hasher
+	authenticator *mfa.Authenticator
+}
+
+type RegistrationOptionsCommand struct {
+	AccountID string
+	Password  string
+	MFACode   string
+}
+
+type RegistrationOptionsCommandResponse struct {
+	Challenge     string
+	Email         string
+	CredentialIDs [][]byte
+}
+
+func NewRegistrationOptionsCommandHandler(
+	db *sql.DB,
+	hasher crypto.Hasher,
+	authenticator *mfa.Authenticator,
+) *RegistrationOptionsCommandHandler {
+	return &RegistrationOptionsCommandHandler{db: db, hasher: hasher, authenticator: authenticator}
+}
+
+func (h *RegistrationOptionsCommandHandler) Execute(
+	cmd RegistrationOptionsCommand,
+) (RegistrationOptionsCommandResponse, error) {
+	query := "SELECT email, password_hash FROM account WHERE id = $1"
+	var email string
+	var passwordHash string
+	err := h.db.QueryRow(query, cmd.AccountID).Scan(&email, &passwordHash)
+	if err != nil {
+		return RegistrationOptionsCommandResponse{}, err
+	}
+	if !h.hasher.Match(passwordHash, cmd.Password) {
+		return RegistrationOptionsCommandResponse{}, InvalidPasswordError
+	}
+	required, err := h.authenticator.Required(cmd.AccountID)
+	if err != nil {
+		return RegistrationOptionsCommandResponse{}, err
+	}
+	if required {
+		if cmd.MFACode == "" {
+			return RegistrationOptionsCommandResponse{}, mfa.RequiredError
+		}
+		err = h.authenticator.Verify(cmd.AccountID, cmd.MFACode)
+		if err != nil {
+			return RegistrationOptionsCommandResponse{}, err
+		}
+	}
+	// The passkeys already registered are excluded, an authenticator holding one of them refuses
+	// to create another for the same account.
+	query = "SELECT credential_id FROM webauthn_credential WHERE account_id = $1"
+	rows, err := h.db.Query(query, cmd.AccountID)
+	if err != nil {
+		return RegistrationOptionsCommandResponse{}, err
+	}
+	defer rows.Close()
+	ids := make([][]byte, 0)
+	for rows.Next() {
+		var id []byte
+		err = rows.Scan(&id)
+		if err != nil {
+			return RegistrationOptionsCommandResponse{}, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return RegistrationOptionsCommandResponse{}, err
+	}
+
+	challenge, err := webauthn.NewChallenge(h.db, webauthn.CeremonyRegistration, cmd.AccountID)
+	if err != nil {
+		return RegistrationOptionsCommandResponse{}, err
+	}
+	return RegistrationOptionsCommandResponse{Challenge: challenge, Email: email, CredentialIDs: ids}, nil
+}
+
+// RegistrationRequest carries the response of the authenticator, base64url encoded.
+type RegistrationRequest struct {
+	Name              string `json:"name" validate:"max=64"`
+	ClientDataJSON    string `json:"client_data_json" validate:"required,max=4096"`
+	AttestationObject string `json:"attestation_object" validate:"required,max=16384"`
+}
+
+func NewRegistrationHandler(cmdHandler cqrs.CommandHandler[RegistrationCommand]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request RegistrationRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		claims := c.Get("claims").(jwt.MapClaims)
+		sub, err := claims.GetSubject()
+		if err != nil {
+			return err
+		}
+		invalidResponse := apierr.ErrorResponse{
+			Code:    ErrInvalidWebAuthnResponse,
+			Message: "The response of the authenticator is invalid",
+		}
+		clientDataJSON, err := webauthn.DecodeBase64URL(request.ClientDataJSON)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, invalidResponse)
+		}
+		attestationObject, err := webauthn.DecodeBase64URL(request.AttestationObject)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, invalidResponse)
+		}
+		cmd := RegistrationCommand{
+			AccountID:         sub,
+			Name:              request.Name,
+			ClientDataJSON:    clientDataJSON,
+			AttestationObject: attestationObject,
+		}
+		err = cmdHandler.Execute(cmd)
+		if err != nil {
+			if err == webauthn.InvalidChallengeError {
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrInvalidWebAuthnChallenge,
+					Message: "The challenge is invalid or expired",
+				})
+			}
+			if err == AlreadyRegisteredError {
+				return c.JSON(http.StatusConflict, apierr.ErrorResponse{
+					Code:    ErrPasskeyAlreadyRegistered,
+					Message: "The passkey is already registered",
+				})
+			}
+			if webauthn.IsVerificationError(err) {
+				return c.JSON(http.StatusBadRequest, invalidResponse)
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+type RegistrationCommandHandler struct {
+	opt          config.WebAuthnOptions
+	db           *sql.DB
+	rp           *webauthn.RelyingParty
+	emailFactory mail.Factory[passkeyadded.Data]
+	emailer      mail.Emailer
+}
+
+type RegistrationCommand struct {
+	AccountID         string
+	Name              string
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+func NewRegistrationCommandHandler(
+	opt config.WebAuthnOptions,
+	db *sql.DB,
+	rp *webauthn.RelyingParty,
+	emailFactory mail.Factory[passkeyadded.Data],
+	emailer mail.Emailer,
+) *RegistrationCommandHandler {
+	return &RegistrationCommandHandler{opt: opt, db: db, rp: rp, emailFactory: emailFactory, emailer: emailer}
+}
+
+// Execute lets the owner know by email, the passkey is a way into the account which outlives any session.
+// The email goes out before the commit, so no passkey is added without it.
+func (h *RegistrationCommandHandler) Execute(cmd RegistrationCommand) error {
+	challenge, err := webauthn.ChallengeOf(cmd.ClientDataJSON)
+	if err != nil {
+		return err
+	}
+	lifetime := time.Duration(h.opt.ChallengeLifetimeSeconds) * time.Second
+	accountID, err := webauthn.ConsumeChallenge(h.db, challenge, webauthn.CeremonyRegistration, lifetime)
+	if err != nil {
+		return err
+	}
+	if accountID != cmd.AccountID {
+		return webauthn.InvalidChallengeError
+	}
+	credential, err := h.rp.VerifyRegistration(challenge, cmd.ClientDataJSON, cmd.AttestationObject)
+	if err != nil {
+		return err
+	}
+	name := cmd.Name
+	if name == "" {
+		name = "Passkey"
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO webauthn_credential (credential_id, public_key, sign_count, name, created_at, account_id)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				ON CONFLICT (credential_id) DO NOTHING`
+	result, err := tx.Exec(query, credential.ID, credential.PublicKey, credential.SignCount, name,
+		time.Now().UTC(), cmd.AccountID)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return AlreadyRegisteredError
+	}
+	query = "SELECT email FROM account WHERE id = $1"
+	var email string
+	err = tx.QueryRow(query, cmd.AccountID).Scan(&email)
+	if err != nil {
+		return err
+	}
+	ctx := mail.Context[passkeyadded.Data]{To: email, Data: passkeyadded.Data{Name: name}}
+	e, err := h.emailFactory.Create(ctx)
+	if err != nil {
+		return err
+	}
+	err = h.emailer.Send(e)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+var (
+	InvalidPasswordError   = errors.New("password is invalid")
+	AlreadyRegisteredError = errors.New("passkey is already registered")
+)
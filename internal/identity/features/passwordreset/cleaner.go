@@ -0,0 +1,38 @@
+package passwordreset
+
+import (
+	"database/sql"
+	"sw/internal/logging"
+	"time"
+)
+
+type PasswordResetsCleaner struct {
+	db     *sql.DB
+	logger logging.Logger
+}
+
+func NewPasswordResetsCleaner(db *sql.DB, logger logging.Logger) *PasswordResetsCleaner {
+	return &PasswordResetsCleaner{db: db, logger: logger}
+}
+
+func (c *PasswordResetsCleaner) Clean() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := c.cleanupDatabase()
+			if err != nil {
+				c.logger.Println("An error occurred during password resets cleaning:", err)
+			}
+		}
+	}
+}
+
+func (c *PasswordResetsCleaner) cleanupDatabase() error {
+	exp := time.Now().UTC().Add(-tokenLifetime)
+	query := "DELETE FROM password_reset_token WHERE created_at < $1"
+	_, err := c.db.Exec(query, exp)
+	return err
+}
@@ -0,0 +1,140 @@
+package passwordreset
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/internal/apierr"
+	"sw/internal/cqrs"
+	"sw/internal/identity/crypto"
+	"sw/internal/identity/passwordpolicy"
+	"sw/internal/identity/tokens"
+	"time"
+)
+
+const (
+	ErrInvalidPasswordReset = "ERR_INVALID_PASSWORD_RESET"
+)
+
+// tokenLifetime is short, a reset token is as good as the password it replaces.
+const tokenLifetime = time.Hour
+
+type PasswordResetConfirmRequest struct {
+	Token    string `json:"token" validate:"required,max=64"`
+	Password string `json:"password" validate:"required,max=1024"`
+}
+
+func NewPasswordResetConfirmHandler(cmdHandler cqrs.CommandHandler[PasswordResetConfirmCommand]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request PasswordResetConfirmRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		cmd := PasswordResetConfirmCommand{Token: request.Token, Password: request.Password}
+		err = cmdHandler.Execute(cmd)
+		if err != nil {
+			if err == InvalidPasswordResetError {
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrInvalidPasswordReset,
+					Message: "The token is invalid or expired",
+				})
+			}
+			var violationErr *passwordpolicy.ViolationError
+			if errors.As(err, &violationErr) {
+				return c.JSON(http.StatusBadRequest, passwordpolicy.MapViolationError("password", violationErr))
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+type PasswordResetConfirmCommandHandler struct {
+	db      *sql.DB
+	hasher  crypto.Hasher
+	policy  *passwordpolicy.Policy
+	history *passwordpolicy.History
+}
+
+type PasswordResetConfirmCommand struct {
+	Token    string
+	Password string
+}
+
+func NewPasswordResetConfirmCommandHandler(
+	db *sql.DB,
+	hasher crypto.Hasher,
+	policy *passwordpolicy.Policy,
+	history *passwordpolicy.History,
+) *PasswordResetConfirmCommandHandler {
+	return &PasswordResetConfirmCommandHandler{db: db, hasher: hasher, policy: policy, history: history}
+}
+
+// Execute sets the new password and signs the account out everywhere, as whoever knew the old
+// password may still hold a session.
+func (h *PasswordResetConfirmCommandHandler) Execute(cmd PasswordResetConfirmCommand) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	exp := time.Now().UTC().Add(-tokenLifetime)
+	query := `DELETE FROM password_reset_token WHERE value = $1 AND created_at > $2 RETURNING account_id`
+	var accountID string
+	err = tx.QueryRow(query, cmd.Token, exp).Scan(&accountID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return InvalidPasswordResetError
+		}
+		return err
+	}
+	query = "SELECT email, password_hash FROM account WHERE id = $1 FOR UPDATE"
+	var email string
+	var currentHash string
+	err = tx.QueryRow(query, accountID).Scan(&email, &currentHash)
+	if err != nil {
+		return err
+	}
+	// A rejected password rolls the token deletion back, so the link can be used for another try.
+	err = h.policy.Enforce(cmd.Password, email)
+	if err != nil {
+		return err
+	}
+	err = h.history.Check(tx, accountID, currentHash, cmd.Password)
+	if err != nil {
+		return err
+	}
+	passwordHash, err := h.hasher.Hash(cmd.Password)
+	if err != nil {
+		return err
+	}
+	query = "UPDATE account SET password_hash = $1 WHERE id = $2"
+	_, err = tx.Exec(query, passwordHash, accountID)
+	if err != nil {
+		return err
+	}
+	err = h.history.Record(tx, accountID, currentHash)
+	if err != nil {
+		return err
+	}
+	// Other links sent before are void once the password has been chosen.
+	query = "DELETE FROM password_reset_token WHERE account_id = $1"
+	_, err = tx.Exec(query, accountID)
+	if err != nil {
+		return err
+	}
+	err = tokens.RevokeAll(tx, accountID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+var InvalidPasswordResetError = errors.New("password reset token is invalid or expired")
@@ -0,0 +1,76 @@
+package passwordreset
+
+import (
+	"database/sql"
+	"github.com/labstack/echo/v4"
+	"sw/internal/cqrs"
+	"sw/internal/identity/mail/passwordreset"
+	"sw/internal/mail"
+	"sw/internal/random"
+	"time"
+)
+
+type PasswordResetRequest struct {
+	Email string `json:"email" validate:"required,max=320,email"`
+}
+
+func NewPasswordResetRequestHandler(cmdHandler cqrs.CommandHandler[PasswordResetRequestCommand]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request PasswordResetRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		cmd := PasswordResetRequestCommand{Email: request.Email}
+		return cmdHandler.Execute(cmd)
+	}
+}
+
+type PasswordResetRequestCommandHandler struct {
+	db           *sql.DB
+	emailFactory mail.Factory[passwordreset.Data]
+	emailer      mail.Emailer
+}
+
+type PasswordResetRequestCommand struct {
+	Email string
+}
+
+func NewPasswordResetRequestCommandHandler(
+	db *sql.DB,
+	emailFactory mail.Factory[passwordreset.Data],
+	emailer mail.Emailer,
+) *PasswordResetRequestCommandHandler {
+	return &PasswordResetRequestCommandHandler{db: db, emailFactory: emailFactory, emailer: emailer}
+}
+
+// Execute succeeds for unknown emails as well, so the endpoint can't be used to find out who has an account.
+func (h *PasswordResetRequestCommandHandler) Execute(cmd PasswordResetRequestCommand) error {
+	query := "SELECT id, email FROM account WHERE email = $1"
+	var id int64
+	var email string
+	err := h.db.QueryRow(query, cmd.Email).Scan(&id, &email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	token := random.Secret(32)
+	query = "INSERT INTO password_reset_token VALUES (DEFAULT, $1, $2, $3)"
+	_, err = h.db.Exec(query, token, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	ctx := mail.Context[passwordreset.Data]{To: email, Data: passwordreset.Data{ResetToken: token}}
+	e, err := h.emailFactory.Create(ctx)
+	if err != nil {
+		return err
+	}
+	return h.emailer.Send(e)
+}
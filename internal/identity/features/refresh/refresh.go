@@ -0,0 +1,194 @@
+package refresh
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/internal/apierr"
+	"sw/internal/cqrs"
+	"sw/internal/identity/tokens"
+	"sw/internal/logging"
+	"time"
+)
+
+const (
+	ErrInvalidRefreshToken = "ERR_INVALID_REFRESH_TOKEN"
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required,max=64"`
+}
+
+type RefreshResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+}
+
+func NewRefreshHandler(
+	cmdHandler cqrs.CommandHandlerWithResponse[RefreshCommand, RefreshCommandResponse],
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request RefreshRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		cmd := RefreshCommand{
+			RefreshToken: request.RefreshToken,
+			UserAgent:    c.Request().UserAgent(),
+			IP:           c.RealIP(),
+		}
+		cmdResponse, err := cmdHandler.Execute(cmd)
+		if err != nil {
+			if err == InvalidRefreshTokenError {
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrInvalidRefreshToken,
+					Message: "The refresh token is invalid or expired",
+				})
+			}
+			return err
+		}
+		response := RefreshResponse{
+			AccessToken:  cmdResponse.AccessToken,
+			RefreshToken: cmdResponse.RefreshToken,
+			IDToken:      cmdResponse.IDToken,
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+}
+
+type RefreshCommandHandler struct {
+	issuer *tokens.Issuer
+	db     *sql.DB
+	logger logging.Logger
+}
+
+type RefreshCommand struct {
+	RefreshToken string
+	UserAgent    string
+	IP           string
+}
+
+type RefreshCommandResponse struct {
+	AccessToken  string
+	RefreshToken string
+	IDToken      string
+}
+
+func NewRefreshCommandHandler(issuer *tokens.Issuer, db *sql.DB, logger logging.Logger) *RefreshCommandHandler {
+	return &RefreshCommandHandler{issuer: issuer, db: db, logger: logger}
+}
+
+func (h *RefreshCommandHandler) Execute(cmd RefreshCommand) (RefreshCommandResponse, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return RefreshCommandResponse{}, err
+	}
+	defer tx.Rollback()
+
+	// The row lock serializes concurrent exchanges of the same value, so only the first one
+	// rotates the token and the others are treated as reuse.
+	query := `SELECT t.id, t.family, t.expires_at, t.rotated_at, t.revoked_at, COALESCE(t.client_id, ''),
+					a.id, a.email, a.email_confirmed,
+					(SELECT MIN(created_at) FROM refresh_token WHERE family = t.family)
+				FROM refresh_token t
+				JOIN account a ON a.id = t.account_id
+				WHERE t.value = $1
+				FOR UPDATE OF t`
+	var tokenID int64
+	var family string
+	var expiresAt time.Time
+	var rotatedAt sql.NullTime
+	var revokedAt sql.NullTime
+	var clientID string
+	var id string
+	var email string
+	var emailConfirmed bool
+	var authTime time.Time
+	err = tx.QueryRow(query, cmd.RefreshToken).
+		Scan(&tokenID, &family, &expiresAt, &rotatedAt, &revokedAt, &clientID, &id, &email, &emailConfirmed, &authTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return RefreshCommandResponse{}, InvalidRefreshTokenError
+		}
+		return RefreshCommandResponse{}, err
+	}
+	now := time.Now().UTC()
+	if rotatedAt.Valid {
+		err = h.revokeReusedFamily(tx, tokenID, family, id, now)
+		if err != nil {
+			return RefreshCommandResponse{}, err
+		}
+		return RefreshCommandResponse{}, InvalidRefreshTokenError
+	}
+	if revokedAt.Valid || !expiresAt.After(now) {
+		return RefreshCommandResponse{}, InvalidRefreshTokenError
+	}
+
+	query = "UPDATE refresh_token SET rotated_at = $1 WHERE id = $2"
+	_, err = tx.Exec(query, now, tokenID)
+	if err != nil {
+		return RefreshCommandResponse{}, err
+	}
+	accessToken, err := h.issuer.AccessToken(id, email)
+	if err != nil {
+		return RefreshCommandResponse{}, err
+	}
+	refreshToken, err := h.issuer.RotateRefreshToken(tx, id, family, tokenID, tokens.Origin{
+		UserAgent: cmd.UserAgent,
+		IP:        cmd.IP,
+		ClientID:  clientID,
+	})
+	if err != nil {
+		return RefreshCommandResponse{}, err
+	}
+	// The family started with the sign-in, so its first token tells when the account authenticated.
+	idToken, err := h.issuer.IDToken(tokens.IDToken{
+		Subject:       id,
+		Email:         email,
+		EmailVerified: emailConfirmed,
+		AuthTime:      authTime,
+	})
+	if err != nil {
+		return RefreshCommandResponse{}, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return RefreshCommandResponse{}, err
+	}
+	return RefreshCommandResponse{AccessToken: accessToken, RefreshToken: refreshToken, IDToken: idToken}, nil
+}
+
+// revokeReusedFamily handles an already rotated token being presented again. Either the legitimate
+// client or an attacker holds a stale copy, and there is no telling which, so the whole family goes.
+func (h *RefreshCommandHandler) revokeReusedFamily(
+	tx *sql.Tx,
+	tokenID int64,
+	family string,
+	accountID string,
+	now time.Time,
+) error {
+	err := tokens.RevokeFamily(tx, family)
+	if err != nil {
+		return err
+	}
+	query := "INSERT INTO refresh_token_reuse VALUES (DEFAULT, $1, $2, $3, $4)"
+	_, err = tx.Exec(query, tokenID, family, accountID, now)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	h.logger.Println("Refresh token reuse detected, token family revoked for account:", accountID)
+	return nil
+}
+
+var InvalidRefreshTokenError = errors.New("refresh token is invalid or expired")
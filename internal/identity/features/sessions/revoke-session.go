@@ -0,0 +1,71 @@
+package sessions
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"sw/internal/apierr"
+	"sw/internal/cqrs"
+	"sw/internal/identity/tokens"
+)
+
+const (
+	ErrSessionNotFound = "ERR_SESSION_NOT_FOUND"
+)
+
+func NewRevokeSessionHandler(cmdHandler cqrs.CommandHandler[RevokeSessionCommand]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		claims := c.Get("claims").(jwt.MapClaims)
+		sub, err := claims.GetSubject()
+		if err != nil {
+			return err
+		}
+		notFound := apierr.ErrorResponse{Code: ErrSessionNotFound, Message: "The session does not exist"}
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, notFound)
+		}
+		cmd := RevokeSessionCommand{AccountID: sub, SessionID: id}
+		err = cmdHandler.Execute(cmd)
+		if err != nil {
+			if err == SessionNotFoundError {
+				return c.JSON(http.StatusNotFound, notFound)
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+type RevokeSessionCommandHandler struct {
+	db *sql.DB
+}
+
+type RevokeSessionCommand struct {
+	AccountID string
+	SessionID int64
+}
+
+func NewRevokeSessionCommandHandler(db *sql.DB) *RevokeSessionCommandHandler {
+	return &RevokeSessionCommandHandler{db: db}
+}
+
+// Execute revokes the family of the given token. A session id which has been rotated in the meantime
+// still identifies the same family, so a listing that went stale doesn't fail the revocation.
+func (h *RevokeSessionCommandHandler) Execute(cmd RevokeSessionCommand) error {
+	query := "SELECT family FROM refresh_token WHERE id = $1 AND account_id = $2"
+	var family string
+	err := h.db.QueryRow(query, cmd.SessionID, cmd.AccountID).Scan(&family)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return SessionNotFoundError
+		}
+		return err
+	}
+	return tokens.RevokeFamily(h.db, family)
+}
+
+var SessionNotFoundError = errors.New("session not found")
@@ -0,0 +1,95 @@
+package sessions
+
+import (
+	"database/sql"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/internal/cqrs"
+	"time"
+)
+
+type SessionResponse struct {
+	ID         int64     `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+func NewSessionsHandler(queryHandler cqrs.QueryHandler[SessionsQuery, []Session]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		claims := c.Get("claims").(jwt.MapClaims)
+		sub, err := claims.GetSubject()
+		if err != nil {
+			return err
+		}
+		query := SessionsQuery{AccountID: sub}
+		sessions, err := queryHandler.Execute(query)
+		if err != nil {
+			return err
+		}
+		response := make([]SessionResponse, 0, len(sessions))
+		for _, s := range sessions {
+			response = append(response, SessionResponse{
+				ID:         s.ID,
+				UserAgent:  s.UserAgent,
+				IP:         s.IP,
+				CreatedAt:  s.CreatedAt,
+				LastUsedAt: s.LastUsedAt,
+			})
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+}
+
+type SessionsQueryHandler struct {
+	db *sql.DB
+}
+
+type SessionsQuery struct {
+	AccountID string
+}
+
+// Session is the current refresh token of a token family. Its id changes with every rotation,
+// while CreatedAt is the time of the sign-in which started the family.
+type Session struct {
+	ID         int64
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+func NewSessionsQueryHandler(db *sql.DB) *SessionsQueryHandler {
+	return &SessionsQueryHandler{db: db}
+}
+
+func (h *SessionsQueryHandler) Execute(query SessionsQuery) ([]Session, error) {
+	sqlQuery := `SELECT t.id, t.user_agent, t.ip, f.created_at, t.last_used_at
+				FROM refresh_token t
+				JOIN (
+					SELECT family, MIN(created_at) AS created_at
+					FROM refresh_token
+					WHERE account_id = $1
+					GROUP BY family
+				) f ON f.family = t.family
+				WHERE t.account_id = $1 AND t.rotated_at IS NULL AND t.revoked_at IS NULL AND t.expires_at > $2
+				ORDER BY t.last_used_at DESC`
+	rows, err := h.db.Query(sqlQuery, query.AccountID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+	for rows.Next() {
+		var s Session
+		err = rows.Scan(&s.ID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
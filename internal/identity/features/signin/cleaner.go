@@ -0,0 +1,70 @@
+package signin
+
+import (
+	"database/sql"
+	"sw/internal/logging"
+	"time"
+)
+
+type ChallengesCleaner struct {
+	db       *sql.DB
+	logger   logging.Logger
+	lifetime time.Duration
+}
+
+func NewChallengesCleaner(db *sql.DB, logger logging.Logger, lifetime time.Duration) *ChallengesCleaner {
+	return &ChallengesCleaner{db: db, logger: logger, lifetime: lifetime}
+}
+
+func (c *ChallengesCleaner) Clean() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := c.cleanupDatabase()
+			if err != nil {
+				c.logger.Println("An error occurred during mfa challenges cleaning:", err)
+			}
+		}
+	}
+}
+
+func (c *ChallengesCleaner) cleanupDatabase() error {
+	exp := time.Now().UTC().Add(-c.lifetime)
+	query := "DELETE FROM mfa_challenge WHERE created_at < $1"
+	_, err := c.db.Exec(query, exp)
+	return err
+}
+
+type MagicLinksCleaner struct {
+	db     *sql.DB
+	logger logging.Logger
+}
+
+func NewMagicLinksCleaner(db *sql.DB, logger logging.Logger) *MagicLinksCleaner {
+	return &MagicLinksCleaner{db: db, logger: logger}
+}
+
+func (c *MagicLinksCleaner) Clean() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := c.cleanupDatabase()
+			if err != nil {
+				c.logger.Println("An error occurred during magic links cleaning:", err)
+			}
+		}
+	}
+}
+
+func (c *MagicLinksCleaner) cleanupDatabase() error {
+	exp := time.Now().UTC().Add(-magicLinkLifetime)
+	query := "DELETE FROM magic_link_token WHERE created_at < $1"
+	_, err := c.db.Exec(query, exp)
+	return err
+}
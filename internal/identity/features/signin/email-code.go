@@ -0,0 +1,184 @@
+package signin
+
+import (
+	"database/sql"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/config"
+	"sw/internal/apierr"
+	"sw/internal/cqrs"
+	"sw/internal/identity/credentials"
+	"sw/internal/identity/emailotp"
+	"sw/internal/identity/mail/signincode"
+	"sw/internal/identity/mfa"
+	"sw/internal/identity/tokens"
+	"sw/internal/mail"
+)
+
+const (
+	ErrInvalidEmailCode = "ERR_INVALID_EMAIL_CODE"
+	ErrEmailCodeLocked  = "ERR_EMAIL_CODE_LOCKED"
+)
+
+type EmailCodeRequest struct {
+	Email string `json:"email" validate:"required,max=320,email"`
+}
+
+func NewEmailCodeHandler(cmdHandler cqrs.CommandHandler[EmailCodeCommand]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request EmailCodeRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		cmd := EmailCodeCommand{Email: request.Email}
+		return cmdHandler.Execute(cmd)
+	}
+}
+
+type EmailCodeCommandHandler struct {
+	db           *sql.DB
+	codes        *emailotp.Codes
+	emailFactory mail.Factory[signincode.Data]
+	emailer      mail.Emailer
+}
+
+type EmailCodeCommand struct {
+	Email string
+}
+
+func NewEmailCodeCommandHandler(
+	db *sql.DB,
+	codes *emailotp.Codes,
+	emailFactory mail.Factory[signincode.Data],
+	emailer mail.Emailer,
+) *EmailCodeCommandHandler {
+	return &EmailCodeCommandHandler{db: db, codes: codes, emailFactory: emailFactory, emailer: emailer}
+}
+
+// Execute succeeds for unknown emails as well, so the endpoint can't be used to find out who has an account.
+// For the same reason no code is sent, silently, while the account is locked out or its email is not
+// confirmed, as with magic links.
+func (h *EmailCodeCommandHandler) Execute(cmd EmailCodeCommand) error {
+	query := "SELECT id, email FROM account WHERE email = $1 AND email_confirmed"
+	var id string
+	var email string
+	err := h.db.QueryRow(query, cmd.Email).Scan(&id, &email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	code, err := h.codes.Issue(id, emailotp.PurposeSignIn)
+	if err != nil {
+		if err == emailotp.LockedError {
+			return nil
+		}
+		return err
+	}
+	ctx := mail.Context[signincode.Data]{To: email, Data: signincode.Data{Code: code}}
+	e, err := h.emailFactory.Create(ctx)
+	if err != nil {
+		return err
+	}
+	return h.emailer.Send(e)
+}
+
+type EmailCodeSignInRequest struct {
+	Email string `json:"email" validate:"required,max=320,email"`
+	Code  string `json:"code" validate:"required,len=6,numeric"`
+	Nonce string `json:"nonce" validate:"max=256"`
+}
+
+// NewEmailCodeSignInHandler takes the code in place of the password. A second factor, when enabled,
+// is still asked for the same way as after a password sign-in.
+func NewEmailCodeSignInHandler(
+	cmdHandler cqrs.CommandHandlerWithResponse[EmailCodeSignInCommand, SignInCommandResponse],
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request EmailCodeSignInRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		cmd := EmailCodeSignInCommand{
+			Email:     request.Email,
+			Code:      request.Code,
+			Nonce:     request.Nonce,
+			UserAgent: c.Request().UserAgent(),
+			IP:        c.RealIP(),
+		}
+		cmdResponse, err := cmdHandler.Execute(cmd)
+		if err != nil {
+			switch err {
+			case emailotp.InvalidCodeError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrInvalidEmailCode,
+					Message: "The code is invalid or expired",
+				})
+			case emailotp.LockedError:
+				return c.JSON(http.StatusTooManyRequests, apierr.ErrorResponse{
+					Code:    ErrEmailCodeLocked,
+					Message: "Too many wrong codes, try again later",
+				})
+			}
+			return err
+		}
+		return signInResponse(c, cmdResponse)
+	}
+}
+
+type EmailCodeSignInCommandHandler struct {
+	opt           config.MFAOptions
+	issuer        *tokens.Issuer
+	db            *sql.DB
+	codes         *emailotp.Codes
+	authenticator *mfa.Authenticator
+}
+
+type EmailCodeSignInCommand struct {
+	Email     string
+	Code      string
+	Nonce     string
+	UserAgent string
+	IP        string
+}
+
+func NewEmailCodeSignInCommandHandler(
+	opt config.MFAOptions,
+	issuer *tokens.Issuer,
+	db *sql.DB,
+	codes *emailotp.Codes,
+	authenticator *mfa.Authenticator,
+) *EmailCodeSignInCommandHandler {
+	return &EmailCodeSignInCommandHandler{opt: opt, issuer: issuer, db: db, codes: codes, authenticator: authenticator}
+}
+
+// Execute is refused for an account whose email is not confirmed, like the magic link sign-in.
+func (h *EmailCodeSignInCommandHandler) Execute(cmd EmailCodeSignInCommand) (SignInCommandResponse, error) {
+	query := "SELECT id, email, email_confirmed FROM account WHERE email = $1 AND email_confirmed"
+	var account credentials.Account
+	err := h.db.QueryRow(query, cmd.Email).Scan(&account.ID, &account.Email, &account.EmailConfirmed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return SignInCommandResponse{}, emailotp.InvalidCodeError
+		}
+		return SignInCommandResponse{}, err
+	}
+	err = h.codes.Verify(account.ID, emailotp.PurposeSignIn, cmd.Code)
+	if err != nil {
+		return SignInCommandResponse{}, err
+	}
+	origin := tokens.Origin{UserAgent: cmd.UserAgent, IP: cmd.IP}
+	return completeSignIn(h.opt, h.issuer, h.db, h.authenticator, account, cmd.Nonce, origin)
+}
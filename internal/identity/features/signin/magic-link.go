@@ -0,0 +1,176 @@
+package signin
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/config"
+	"sw/internal/apierr"
+	"sw/internal/cqrs"
+	"sw/internal/identity/credentials"
+	"sw/internal/identity/mail/magiclink"
+	"sw/internal/identity/mfa"
+	"sw/internal/identity/tokens"
+	"sw/internal/mail"
+	"sw/internal/random"
+	"time"
+)
+
+const (
+	ErrInvalidMagicLink = "ERR_INVALID_MAGIC_LINK"
+)
+
+// magicLinkLifetime is shorter than the one of a password reset, the link signs in by itself.
+const magicLinkLifetime = 15 * time.Minute
+
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,max=320,email"`
+}
+
+func NewMagicLinkHandler(cmdHandler cqrs.CommandHandler[MagicLinkCommand]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request MagicLinkRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		cmd := MagicLinkCommand{Email: request.Email}
+		return cmdHandler.Execute(cmd)
+	}
+}
+
+type MagicLinkCommandHandler struct {
+	db           *sql.DB
+	emailFactory mail.Factory[magiclink.Data]
+	emailer      mail.Emailer
+}
+
+type MagicLinkCommand struct {
+	Email string
+}
+
+func NewMagicLinkCommandHandler(
+	db *sql.DB,
+	emailFactory mail.Factory[magiclink.Data],
+	emailer mail.Emailer,
+) *MagicLinkCommandHandler {
+	return &MagicLinkCommandHandler{db: db, emailFactory: emailFactory, emailer: emailer}
+}
+
+// Execute succeeds for unknown emails as well, so the endpoint can't be used to find out who has an account.
+// Accounts with an unconfirmed email get no link, anyone may have signed up with an address that isn't
+// theirs and kept the password, the owner of the address must not be let into that account.
+func (h *MagicLinkCommandHandler) Execute(cmd MagicLinkCommand) error {
+	query := "SELECT id, email FROM account WHERE email = $1 AND email_confirmed"
+	var id int64
+	var email string
+	err := h.db.QueryRow(query, cmd.Email).Scan(&id, &email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	token := random.Secret(32)
+	query = "INSERT INTO magic_link_token VALUES (DEFAULT, $1, $2, $3)"
+	_, err = h.db.Exec(query, token, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	ctx := mail.Context[magiclink.Data]{To: email, Data: magiclink.Data{Token: token}}
+	e, err := h.emailFactory.Create(ctx)
+	if err != nil {
+		return err
+	}
+	return h.emailer.Send(e)
+}
+
+type MagicLinkSignInRequest struct {
+	Token string `json:"token" validate:"required,max=64"`
+	Nonce string `json:"nonce" validate:"max=256"`
+}
+
+// NewMagicLinkSignInHandler redeems the link in place of the password. A second factor, when enabled,
+// is still asked for the same way as after a password sign-in.
+func NewMagicLinkSignInHandler(
+	cmdHandler cqrs.CommandHandlerWithResponse[MagicLinkSignInCommand, SignInCommandResponse],
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request MagicLinkSignInRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		cmd := MagicLinkSignInCommand{
+			Token:     request.Token,
+			Nonce:     request.Nonce,
+			UserAgent: c.Request().UserAgent(),
+			IP:        c.RealIP(),
+		}
+		cmdResponse, err := cmdHandler.Execute(cmd)
+		if err != nil {
+			if err == InvalidMagicLinkError {
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrInvalidMagicLink,
+					Message: "The link is invalid or expired",
+				})
+			}
+			return err
+		}
+		return signInResponse(c, cmdResponse)
+	}
+}
+
+type MagicLinkSignInCommandHandler struct {
+	opt           config.MFAOptions
+	issuer        *tokens.Issuer
+	db            *sql.DB
+	authenticator *mfa.Authenticator
+}
+
+type MagicLinkSignInCommand struct {
+	Token     string
+	Nonce     string
+	UserAgent string
+	IP        string
+}
+
+func NewMagicLinkSignInCommandHandler(
+	opt config.MFAOptions,
+	issuer *tokens.Issuer,
+	db *sql.DB,
+	authenticator *mfa.Authenticator,
+) *MagicLinkSignInCommandHandler {
+	return &MagicLinkSignInCommandHandler{opt: opt, issuer: issuer, db: db, authenticator: authenticator}
+}
+
+// Execute deletes the token as it is redeemed, so the link works once. Like the link itself, the sign-in
+// is refused for an account whose email is not confirmed.
+func (h *MagicLinkSignInCommandHandler) Execute(cmd MagicLinkSignInCommand) (SignInCommandResponse, error) {
+	exp := time.Now().UTC().Add(-magicLinkLifetime)
+	query := `DELETE FROM magic_link_token t USING account a
+				WHERE a.id = t.account_id AND t.value = $1 AND t.created_at > $2 AND a.email_confirmed
+				RETURNING a.id, a.email, a.email_confirmed`
+	var account credentials.Account
+	err := h.db.QueryRow(query, cmd.Token, exp).Scan(&account.ID, &account.Email, &account.EmailConfirmed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return SignInCommandResponse{}, InvalidMagicLinkError
+		}
+		return SignInCommandResponse{}, err
+	}
+	origin := tokens.Origin{UserAgent: cmd.UserAgent, IP: cmd.IP}
+	return completeSignIn(h.opt, h.issuer, h.db, h.authenticator, account, cmd.Nonce, origin)
+}
+
+var InvalidMagicLinkError = errors.New("magic link is invalid or expired")
@@ -0,0 +1,169 @@
+package signin
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/config"
+	"sw/internal/apierr"
+	"sw/internal/cqrs"
+	"sw/internal/identity/credentials"
+	"sw/internal/identity/mfa"
+	"sw/internal/identity/tokens"
+	"sw/internal/random"
+	"time"
+)
+
+const (
+	ErrInvalidMFAChallenge = "ERR_INVALID_MFA_CHALLENGE"
+	ErrInvalidMFACode      = "ERR_INVALID_MFA_CODE"
+	ErrMFALocked           = "ERR_MFA_LOCKED"
+)
+
+type MFASignInRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required,max=64"`
+	Code           string `json:"code" validate:"required,max=16"`
+}
+
+func NewMFASignInHandler(
+	cmdHandler cqrs.CommandHandlerWithResponse[MFASignInCommand, SignInCommandResponse],
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request MFASignInRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		cmd := MFASignInCommand{
+			ChallengeToken: request.ChallengeToken,
+			Code:           request.Code,
+			UserAgent:      c.Request().UserAgent(),
+			IP:             c.RealIP(),
+		}
+		cmdResponse, err := cmdHandler.Execute(cmd)
+		if err != nil {
+			switch err {
+			case InvalidChallengeError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrInvalidMFAChallenge,
+					Message: "The challenge is invalid or expired, sign in again",
+				})
+			case mfa.InvalidCodeError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrInvalidMFACode,
+					Message: "The code is invalid",
+				})
+			case mfa.LockedError:
+				return c.JSON(http.StatusTooManyRequests, apierr.ErrorResponse{
+					Code:    ErrMFALocked,
+					Message: "Too many wrong codes, try again later",
+				})
+			}
+			return err
+		}
+		return signInResponse(c, cmdResponse)
+	}
+}
+
+// newChallenge holds back the tokens of a sign-in until the second factor is given.
+func newChallenge(opt config.MFAOptions, db *sql.DB, accountID string, nonce string) (SignInCommandResponse, error) {
+	challenge := random.Secret(32)
+	query := "INSERT INTO mfa_challenge (value, nonce, created_at, account_id) VALUES ($1, $2, $3, $4)"
+	_, err := db.Exec(query, challenge, nonce, time.Now().UTC(), accountID)
+	if err != nil {
+		return SignInCommandResponse{}, err
+	}
+	return SignInCommandResponse{ChallengeToken: challenge, ChallengeExpiresIn: opt.ChallengeLifetimeSeconds}, nil
+}
+
+type MFASignInCommandHandler struct {
+	opt           config.MFAOptions
+	issuer        *tokens.Issuer
+	db            *sql.DB
+	authenticator *mfa.Authenticator
+}
+
+type MFASignInCommand struct {
+	ChallengeToken string
+	Code           string
+	UserAgent      string
+	IP             string
+}
+
+func NewMFASignInCommandHandler(
+	opt config.MFAOptions,
+	issuer *tokens.Issuer,
+	db *sql.DB,
+	authenticator *mfa.Authenticator,
+) *MFASignInCommandHandler {
+	return &MFASignInCommandHandler{opt: opt, issuer: issuer, db: db, authenticator: authenticator}
+}
+
+// Execute completes the sign-in started with the password. Every wrong code counts against the
+// challenge, after the allowed attempts the password has to be entered again.
+func (h *MFASignInCommandHandler) Execute(cmd MFASignInCommand) (SignInCommandResponse, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return SignInCommandResponse{}, err
+	}
+	defer tx.Rollback()
+
+	exp := time.Now().UTC().Add(-time.Duration(h.opt.ChallengeLifetimeSeconds) * time.Second)
+	query := `SELECT c.id, c.nonce, c.attempts, a.id, a.email, a.email_confirmed
+				FROM mfa_challenge c JOIN account a ON a.id = c.account_id
+				WHERE c.value = $1 AND c.created_at > $2
+				FOR UPDATE OF c`
+	var id int64
+	var nonce string
+	var attempts int
+	var account credentials.Account
+	err = tx.QueryRow(query, cmd.ChallengeToken, exp).
+		Scan(&id, &nonce, &attempts, &account.ID, &account.Email, &account.EmailConfirmed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return SignInCommandResponse{}, InvalidChallengeError
+		}
+		return SignInCommandResponse{}, err
+	}
+
+	err = h.authenticator.Verify(account.ID, cmd.Code)
+	if err != nil {
+		if err != mfa.InvalidCodeError {
+			return SignInCommandResponse{}, err
+		}
+		if attempts+1 >= h.opt.MaxAttempts {
+			query = "DELETE FROM mfa_challenge WHERE id = $1"
+			_, err = tx.Exec(query, id)
+		} else {
+			query = "UPDATE mfa_challenge SET attempts = attempts + 1 WHERE id = $1"
+			_, err = tx.Exec(query, id)
+		}
+		if err != nil {
+			return SignInCommandResponse{}, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return SignInCommandResponse{}, err
+		}
+		return SignInCommandResponse{}, mfa.InvalidCodeError
+	}
+
+	query = "DELETE FROM mfa_challenge WHERE id = $1"
+	_, err = tx.Exec(query, id)
+	if err != nil {
+		return SignInCommandResponse{}, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return SignInCommandResponse{}, err
+	}
+	origin := tokens.Origin{UserAgent: cmd.UserAgent, IP: cmd.IP}
+	return issueTokens(h.issuer, h.db, account, nonce, origin)
+}
+
+var InvalidChallengeError = errors.New("mfa challenge is invalid or expired")
@@ -0,0 +1,230 @@
+package signin
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/config"
+	"sw/internal/apierr"
+	"sw/internal/cqrs"
+	"sw/internal/identity/credentials"
+	"sw/internal/identity/tokens"
+	"sw/internal/identity/webauthn"
+	"time"
+)
+
+const (
+	ErrInvalidWebAuthnChallenge = "ERR_INVALID_WEBAUTHN_CHALLENGE"
+	ErrInvalidWebAuthnResponse  = "ERR_INVALID_WEBAUTHN_RESPONSE"
+	ErrUnknownPasskey           = "ERR_UNKNOWN_PASSKEY"
+)
+
+// PasskeyOptionsResponse is the PublicKeyCredentialRequestOptionsJSON of WebAuthn Level 3, its member
+// names are kept as browsers parse them with PublicKeyCredential.parseRequestOptionsFromJSON. Passkeys
+// are discoverable, so no credentials are listed and any passkey of the relying party may answer.
+type PasskeyOptionsResponse struct {
+	Challenge        string `json:"challenge"`
+	RPID             string `json:"rpId"`
+	Timeout          int    `json:"timeout"`
+	UserVerification string `json:"userVerification"`
+}
+
+func NewPasskeyOptionsHandler(
+	opt config.WebAuthnOptions,
+	cmdHandler cqrs.CommandHandlerWithResponse[PasskeyOptionsCommand, string],
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		challenge, err := cmdHandler.Execute(PasskeyOptionsCommand{})
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, PasskeyOptionsResponse{
+			Challenge:        challenge,
+			RPID:             opt.RPID,
+			Timeout:          opt.ChallengeLifetimeSeconds * 1000,
+			UserVerification: "required",
+		})
+	}
+}
+
+type PasskeyOptionsCommandHandler struct {
+	db *sql.DB
+}
+
+type PasskeyOptionsCommand struct{}
+
+func NewPasskeyOptionsCommandHandler(db *sql.DB) *PasskeyOptionsCommandHandler {
+	return &PasskeyOptionsCommandHandler{db: db}
+}
+
+func (h *PasskeyOptionsCommandHandler) Execute(cmd PasskeyOptionsCommand) (string, error) {
+	return webauthn.NewChallenge(h.db, webauthn.CeremonyAuthentication, "")
+}
+
+// PasskeySignInRequest carries the response of the authenticator, base64url encoded.
+type PasskeySignInRequest struct {
+	CredentialID      string `json:"credential_id" validate:"required,max=2048"`
+	ClientDataJSON    string `json:"client_data_json" validate:"required,max=4096"`
+	AuthenticatorData string `json:"authenticator_data" validate:"required,max=4096"`
+	Signature         string `json:"signature" validate:"required,max=2048"`
+	UserHandle        string `json:"user_handle" validate:"max=128"`
+	Nonce             string `json:"nonce" validate:"max=256"`
+}
+
+// NewPasskeySignInHandler signs in without a password. The passkey verified the user itself, so no
+// other factor is asked for and the same tokens as for a password sign-in are returned.
+func NewPasskeySignInHandler(
+	cmdHandler cqrs.CommandHandlerWithResponse[PasskeySignInCommand, SignInCommandResponse],
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request PasskeySignInRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		invalidResponse := apierr.ErrorResponse{
+			Code:    ErrInvalidWebAuthnResponse,
+			Message: "The response of the authenticator is invalid",
+		}
+		credentialID, err := webauthn.DecodeBase64URL(request.CredentialID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, invalidResponse)
+		}
+		clientDataJSON, err := webauthn.DecodeBase64URL(request.ClientDataJSON)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, invalidResponse)
+		}
+		authenticatorData, err := webauthn.DecodeBase64URL(request.AuthenticatorData)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, invalidResponse)
+		}
+		signature, err := webauthn.DecodeBase64URL(request.Signature)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, invalidResponse)
+		}
+		cmd := PasskeySignInCommand{
+			CredentialID: credentialID,
+			Assertion: webauthn.Assertion{
+				ClientDataJSON:    clientDataJSON,
+				AuthenticatorData: authenticatorData,
+				Signature:         signature,
+			},
+			UserHandle: request.UserHandle,
+			Nonce:      request.Nonce,
+			UserAgent:  c.Request().UserAgent(),
+			IP:         c.RealIP(),
+		}
+		cmdResponse, err := cmdHandler.Execute(cmd)
+		if err != nil {
+			switch err {
+			case webauthn.InvalidChallengeError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrInvalidWebAuthnChallenge,
+					Message: "The challenge is invalid or expired",
+				})
+			case UnknownPasskeyError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrUnknownPasskey,
+					Message: "The passkey is not registered",
+				})
+			}
+			if webauthn.IsVerificationError(err) {
+				return c.JSON(http.StatusBadRequest, invalidResponse)
+			}
+			return err
+		}
+		response := SignInResponse{
+			AccessToken:  cmdResponse.AccessToken,
+			RefreshToken: cmdResponse.RefreshToken,
+			IDToken:      cmdResponse.IDToken,
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+}
+
+type PasskeySignInCommandHandler struct {
+	opt    config.WebAuthnOptions
+	issuer *tokens.Issuer
+	db     *sql.DB
+	rp     *webauthn.RelyingParty
+}
+
+type PasskeySignInCommand struct {
+	CredentialID []byte
+	Assertion    webauthn.Assertion
+	UserHandle   string
+	Nonce        string
+	UserAgent    string
+	IP           string
+}
+
+func NewPasskeySignInCommandHandler(
+	opt config.WebAuthnOptions,
+	issuer *tokens.Issuer,
+	db *sql.DB,
+	rp *webauthn.RelyingParty,
+) *PasskeySignInCommandHandler {
+	return &PasskeySignInCommandHandler{opt: opt, issuer: issuer, db: db, rp: rp}
+}
+
+func (h *PasskeySignInCommandHandler) Execute(cmd PasskeySignInCommand) (SignInCommandResponse, error) {
+	challenge, err := webauthn.ChallengeOf(cmd.Assertion.ClientDataJSON)
+	if err != nil {
+		return SignInCommandResponse{}, err
+	}
+	lifetime := time.Duration(h.opt.ChallengeLifetimeSeconds) * time.Second
+	_, err = webauthn.ConsumeChallenge(h.db, challenge, webauthn.CeremonyAuthentication, lifetime)
+	if err != nil {
+		return SignInCommandResponse{}, err
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return SignInCommandResponse{}, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT c.id, c.public_key, c.sign_count, a.id, a.email, a.email_confirmed
+				FROM webauthn_credential c JOIN account a ON a.id = c.account_id
+				WHERE c.credential_id = $1
+				FOR UPDATE OF c`
+	var id int64
+	var publicKey []byte
+	var signCount uint32
+	var account credentials.Account
+	err = tx.QueryRow(query, cmd.CredentialID).
+		Scan(&id, &publicKey, &signCount, &account.ID, &account.Email, &account.EmailConfirmed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return SignInCommandResponse{}, UnknownPasskeyError
+		}
+		return SignInCommandResponse{}, err
+	}
+	// The user handle is the account id the passkey was created for, see the registration options.
+	if cmd.UserHandle != "" && cmd.UserHandle != base64.RawURLEncoding.EncodeToString([]byte(account.ID)) {
+		return SignInCommandResponse{}, UnknownPasskeyError
+	}
+	signCount, err = h.rp.VerifyAssertion(challenge, publicKey, signCount, cmd.Assertion)
+	if err != nil {
+		return SignInCommandResponse{}, err
+	}
+	query = "UPDATE webauthn_credential SET sign_count = $1, last_used_at = $2 WHERE id = $3"
+	_, err = tx.Exec(query, signCount, time.Now().UTC(), id)
+	if err != nil {
+		return SignInCommandResponse{}, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return SignInCommandResponse{}, err
+	}
+	origin := tokens.Origin{UserAgent: cmd.UserAgent, IP: cmd.IP}
+	return issueTokens(h.issuer, h.db, account, cmd.Nonce, origin)
+}
+
+var UnknownPasskeyError = errors.New("passkey is not registered")
@@ -2,15 +2,14 @@ package signin
 
 import (
 	"database/sql"
-	"errors"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 	"net/http"
 	"sw/config"
 	"sw/internal/apierr"
 	"sw/internal/cqrs"
-	"sw/internal/identity/crypto"
-	"sw/internal/random"
+	"sw/internal/identity/credentials"
+	"sw/internal/identity/mfa"
+	"sw/internal/identity/tokens"
 	"time"
 )
 
@@ -20,12 +19,22 @@ const (
 
 type SignInRequest struct {
 	Email    string `json:"email" validate:"required,max=320,email"`
-	Password string `json:"password" validate:"required,min=8,max=64"`
+	Password string `json:"password" validate:"required,max=1024"`
+	Nonce    string `json:"nonce" validate:"max=256"`
 }
 
 type SignInResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+}
+
+// SignInMFAResponse is returned instead of the tokens when the account has a second factor enabled.
+// The challenge token is exchanged for the tokens together with a code at the MFA sign-in handler.
+type SignInMFAResponse struct {
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int    `json:"expires_in"`
 }
 
 func NewSignInHandler(
@@ -41,10 +50,16 @@ func NewSignInHandler(
 		if err != nil {
 			return err
 		}
-		cmd := SignInCommand{Email: request.Email, Password: request.Password}
+		cmd := SignInCommand{
+			Email:     request.Email,
+			Password:  request.Password,
+			Nonce:     request.Nonce,
+			UserAgent: c.Request().UserAgent(),
+			IP:        c.RealIP(),
+		}
 		cmdResponse, err := cmdHandler.Execute(cmd)
 		if err != nil {
-			if err == InvalidCredentialsError {
+			if err == credentials.InvalidCredentialsError {
 				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
 					Code:    ErrInvalidCredentials,
 					Message: "Credentials are invalid"},
@@ -52,71 +67,115 @@ func NewSignInHandler(
 			}
 			return err
 		}
-		response := SignInResponse{AccessToken: cmdResponse.AccessToken, RefreshToken: cmdResponse.RefreshToken}
-		return c.JSON(http.StatusOK, response)
+		return signInResponse(c, cmdResponse)
+	}
+}
+
+func signInResponse(c echo.Context, cmdResponse SignInCommandResponse) error {
+	if cmdResponse.ChallengeToken != "" {
+		return c.JSON(http.StatusOK, SignInMFAResponse{
+			MFARequired:    true,
+			ChallengeToken: cmdResponse.ChallengeToken,
+			ExpiresIn:      cmdResponse.ChallengeExpiresIn,
+		})
 	}
+	response := SignInResponse{
+		AccessToken:  cmdResponse.AccessToken,
+		RefreshToken: cmdResponse.RefreshToken,
+		IDToken:      cmdResponse.IDToken,
+	}
+	return c.JSON(http.StatusOK, response)
 }
 
 type SignInCommandHandler struct {
-	opt    config.JwtOptions
-	secret []byte
-	db     *sql.DB
-	hasher crypto.Hasher
+	opt           config.MFAOptions
+	issuer        *tokens.Issuer
+	db            *sql.DB
+	verifier      *credentials.Verifier
+	authenticator *mfa.Authenticator
 }
 
 type SignInCommand struct {
-	Email    string
-	Password string
+	Email     string
+	Password  string
+	Nonce     string
+	UserAgent string
+	IP        string
 }
 
+// SignInCommandResponse holds either the tokens, or the challenge token when a second factor is required.
 type SignInCommandResponse struct {
-	AccessToken  string
-	RefreshToken string
+	AccessToken        string
+	RefreshToken       string
+	IDToken            string
+	ChallengeToken     string
+	ChallengeExpiresIn int
 }
 
 func NewSignInCommandHandler(
-	opt config.JwtOptions,
-	secret []byte,
+	opt config.MFAOptions,
+	issuer *tokens.Issuer,
 	db *sql.DB,
-	hasher crypto.Hasher,
+	verifier *credentials.Verifier,
+	authenticator *mfa.Authenticator,
 ) *SignInCommandHandler {
-	return &SignInCommandHandler{opt: opt, secret: secret, db: db, hasher: hasher}
+	return &SignInCommandHandler{opt: opt, issuer: issuer, db: db, verifier: verifier, authenticator: authenticator}
 }
 
 func (h *SignInCommandHandler) Execute(cmd SignInCommand) (SignInCommandResponse, error) {
-	query := "SELECT id, email, email_confirmed, password_hash FROM account WHERE email = $1"
-	var id string
-	var email string
-	var emailConfirmed bool
-	var passwordHash string
-	err := h.db.QueryRow(query, cmd.Email).Scan(&id, &email, &emailConfirmed, &passwordHash)
+	account, err := h.verifier.Verify(cmd.Email, cmd.Password)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return SignInCommandResponse{}, InvalidCredentialsError
-		}
 		return SignInCommandResponse{}, err
 	}
-	if h.hasher.Match(passwordHash, cmd.Password) {
-		claims := jwt.MapClaims{
-			"sub":   id,
-			"exp":   time.Now().Add(time.Minute * time.Duration(h.opt.AccessTokenLifetimeMinutes)).Unix(),
-			"email": email,
-		}
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-		accessToken, err := token.SignedString(h.secret)
-		if err != nil {
-			return SignInCommandResponse{}, err
-		}
-		refreshToken := random.String(64)
-		expiresAt := time.Now().UTC().AddDate(0, 0, h.opt.RefreshTokenLifetimeDays)
-		query = "INSERT INTO refresh_token VALUES (DEFAULT, $1, $2, $3)"
-		_, err = h.db.Exec(query, refreshToken, expiresAt, id)
-		if err != nil {
-			return SignInCommandResponse{}, err
-		}
-		return SignInCommandResponse{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+	origin := tokens.Origin{UserAgent: cmd.UserAgent, IP: cmd.IP}
+	return completeSignIn(h.opt, h.issuer, h.db, h.authenticator, account, cmd.Nonce, origin)
+}
+
+// completeSignIn asks for the second factor when the account has one enabled, and issues the tokens
+// otherwise. It follows whatever stood in for the password.
+func completeSignIn(
+	opt config.MFAOptions,
+	issuer *tokens.Issuer,
+	db *sql.DB,
+	authenticator *mfa.Authenticator,
+	account credentials.Account,
+	nonce string,
+	origin tokens.Origin,
+) (SignInCommandResponse, error) {
+	required, err := authenticator.Required(account.ID)
+	if err != nil {
+		return SignInCommandResponse{}, err
+	}
+	if required {
+		return newChallenge(opt, db, account.ID, nonce)
 	}
-	return SignInCommandResponse{}, InvalidCredentialsError
+	return issueTokens(issuer, db, account, nonce, origin)
 }
 
-var InvalidCredentialsError = errors.New("invalid credentials")
+func issueTokens(
+	issuer *tokens.Issuer,
+	db *sql.DB,
+	account credentials.Account,
+	nonce string,
+	origin tokens.Origin,
+) (SignInCommandResponse, error) {
+	accessToken, err := issuer.AccessToken(account.ID, account.Email)
+	if err != nil {
+		return SignInCommandResponse{}, err
+	}
+	refreshToken, err := issuer.RefreshToken(db, account.ID, origin)
+	if err != nil {
+		return SignInCommandResponse{}, err
+	}
+	idToken, err := issuer.IDToken(tokens.IDToken{
+		Subject:       account.ID,
+		Email:         account.Email,
+		EmailVerified: account.EmailConfirmed,
+		Nonce:         nonce,
+		AuthTime:      time.Now(),
+	})
+	if err != nil {
+		return SignInCommandResponse{}, err
+	}
+	return SignInCommandResponse{AccessToken: accessToken, RefreshToken: refreshToken, IDToken: idToken}, nil
+}
@@ -0,0 +1,37 @@
+package signout
+
+import (
+	"database/sql"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"sw/internal/cqrs"
+	"sw/internal/identity/tokens"
+)
+
+func NewSignOutAllHandler(cmdHandler cqrs.CommandHandler[SignOutAllCommand]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		claims := c.Get("claims").(jwt.MapClaims)
+		sub, err := claims.GetSubject()
+		if err != nil {
+			return err
+		}
+		cmd := SignOutAllCommand{AccountID: sub}
+		return cmdHandler.Execute(cmd)
+	}
+}
+
+type SignOutAllCommandHandler struct {
+	db *sql.DB
+}
+
+type SignOutAllCommand struct {
+	AccountID string
+}
+
+func NewSignOutAllCommandHandler(db *sql.DB) *SignOutAllCommandHandler {
+	return &SignOutAllCommandHandler{db: db}
+}
+
+func (h *SignOutAllCommandHandler) Execute(cmd SignOutAllCommand) error {
+	return tokens.RevokeAll(h.db, cmd.AccountID)
+}
@@ -0,0 +1,58 @@
+package signout
+
+import (
+	"database/sql"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"sw/internal/cqrs"
+	"time"
+)
+
+type SignOutRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required,max=64"`
+}
+
+func NewSignOutHandler(cmdHandler cqrs.CommandHandler[SignOutCommand]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request SignOutRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		claims := c.Get("claims").(jwt.MapClaims)
+		sub, err := claims.GetSubject()
+		if err != nil {
+			return err
+		}
+		cmd := SignOutCommand{AccountID: sub, RefreshToken: request.RefreshToken}
+		return cmdHandler.Execute(cmd)
+	}
+}
+
+type SignOutCommandHandler struct {
+	db *sql.DB
+}
+
+type SignOutCommand struct {
+	AccountID    string
+	RefreshToken string
+}
+
+func NewSignOutCommandHandler(db *sql.DB) *SignOutCommandHandler {
+	return &SignOutCommandHandler{db: db}
+}
+
+// Execute revokes the whole family of the presented token, so a stale token of the same session
+// can't be used either. Unknown tokens and tokens of other accounts are silently ignored.
+func (h *SignOutCommandHandler) Execute(cmd SignOutCommand) error {
+	query := `UPDATE refresh_token SET revoked_at = $1
+				WHERE revoked_at IS NULL AND family = (
+					SELECT family FROM refresh_token WHERE value = $2 AND account_id = $3
+				)`
+	_, err := h.db.Exec(query, time.Now().UTC(), cmd.RefreshToken, cmd.AccountID)
+	return err
+}
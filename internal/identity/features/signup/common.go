@@ -2,12 +2,20 @@ package signup
 
 import (
 	"database/sql"
+	"strconv"
+	"sw/internal/identity/emailotp"
 	"sw/internal/identity/mail/confirmation"
 	"sw/internal/mail"
 	"sw/internal/random"
 	"time"
 )
 
+// Ways of confirming the email, the link is sent unless the code is asked for.
+const (
+	ConfirmationMethodLink = "link"
+	ConfirmationMethodCode = "code"
+)
+
 func sendConfirmationToken(
 	db *sql.DB,
 	emailFactory mail.Factory[confirmation.Data],
@@ -29,3 +37,22 @@ func sendConfirmationToken(
 	err = emailer.Send(e)
 	return err
 }
+
+func sendConfirmationCode(
+	codes *emailotp.Codes,
+	emailFactory mail.Factory[confirmation.CodeData],
+	emailer mail.Emailer,
+	id int64,
+	email string,
+) error {
+	code, err := codes.Issue(strconv.FormatInt(id, 10), emailotp.PurposeConfirmation)
+	if err != nil {
+		return err
+	}
+	ctx := mail.Context[confirmation.CodeData]{To: email, Data: confirmation.CodeData{Code: code}}
+	e, err := emailFactory.Create(ctx)
+	if err != nil {
+		return err
+	}
+	return emailer.Send(e)
+}
@@ -0,0 +1,85 @@
+package signup
+
+import (
+	"database/sql"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/internal/apierr"
+	"sw/internal/cqrs"
+	"sw/internal/identity/emailotp"
+)
+
+const (
+	ErrInvalidEmailCode = "ERR_INVALID_EMAIL_CODE"
+	ErrEmailCodeLocked  = "ERR_EMAIL_CODE_LOCKED"
+)
+
+type EmailCodeConfirmationRequest struct {
+	Email string `json:"email" validate:"required,max=320,email"`
+	Code  string `json:"code" validate:"required,len=6,numeric"`
+}
+
+func NewEmailCodeConfirmationHandler(cmdHandler cqrs.CommandHandler[EmailCodeConfirmationCommand]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request EmailCodeConfirmationRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		cmd := EmailCodeConfirmationCommand{Email: request.Email, Code: request.Code}
+		err = cmdHandler.Execute(cmd)
+		if err != nil {
+			switch err {
+			case emailotp.InvalidCodeError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrInvalidEmailCode,
+					Message: "The code is invalid or expired",
+				})
+			case emailotp.LockedError:
+				return c.JSON(http.StatusTooManyRequests, apierr.ErrorResponse{
+					Code:    ErrEmailCodeLocked,
+					Message: "Too many wrong codes, try again later",
+				})
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+type EmailCodeConfirmationCommandHandler struct {
+	db    *sql.DB
+	codes *emailotp.Codes
+}
+
+type EmailCodeConfirmationCommand struct {
+	Email string
+	Code  string
+}
+
+func NewEmailCodeConfirmationCommandHandler(db *sql.DB, codes *emailotp.Codes) *EmailCodeConfirmationCommandHandler {
+	return &EmailCodeConfirmationCommandHandler{db: db, codes: codes}
+}
+
+func (h *EmailCodeConfirmationCommandHandler) Execute(cmd EmailCodeConfirmationCommand) error {
+	query := "SELECT id FROM account WHERE email = $1"
+	var accountID string
+	err := h.db.QueryRow(query, cmd.Email).Scan(&accountID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return emailotp.InvalidCodeError
+		}
+		return err
+	}
+	err = h.codes.Verify(accountID, emailotp.PurposeConfirmation, cmd.Code)
+	if err != nil {
+		return err
+	}
+	query = "UPDATE account SET email_confirmed = true WHERE id = $1"
+	_, err = h.db.Exec(query, accountID)
+	return err
+}
@@ -3,13 +3,17 @@ package signup
 import (
 	"database/sql"
 	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/internal/apierr"
 	"sw/internal/cqrs"
+	"sw/internal/identity/emailotp"
 	"sw/internal/identity/mail/confirmation"
 	"sw/internal/mail"
 )
 
 type ResendEmailConfirmationRequest struct {
-	Email string `json:"email" validate:"required,max=320,email,exists"`
+	Email              string `json:"email" validate:"required,max=320,email,exists"`
+	ConfirmationMethod string `json:"confirmation_method" validate:"omitempty,oneof=link code"`
 }
 
 func NewResendEmailConfirmationHandler(
@@ -25,27 +29,48 @@ func NewResendEmailConfirmationHandler(
 		if err != nil {
 			return err
 		}
-		cmd := ResendEmailConfirmationCommand{Email: request.Email}
-		return cmdHandler.Execute(cmd)
+		cmd := ResendEmailConfirmationCommand{Email: request.Email, ConfirmationMethod: request.ConfirmationMethod}
+		err = cmdHandler.Execute(cmd)
+		if err != nil {
+			if err == emailotp.LockedError {
+				return c.JSON(http.StatusTooManyRequests, apierr.ErrorResponse{
+					Code:    ErrEmailCodeLocked,
+					Message: "Too many wrong codes, try again later",
+				})
+			}
+			return err
+		}
+		return nil
 	}
 }
 
 type ResendEmailConfirmationCommandHandler struct {
-	db           *sql.DB
-	emailFactory mail.Factory[confirmation.Data]
-	emailer      mail.Emailer
+	db               *sql.DB
+	codes            *emailotp.Codes
+	emailFactory     mail.Factory[confirmation.Data]
+	codeEmailFactory mail.Factory[confirmation.CodeData]
+	emailer          mail.Emailer
 }
 
 type ResendEmailConfirmationCommand struct {
-	Email string
+	Email              string
+	ConfirmationMethod string
 }
 
 func NewResendEmailConfirmationCommandHandler(
 	db *sql.DB,
+	codes *emailotp.Codes,
 	emailFactory mail.Factory[confirmation.Data],
+	codeEmailFactory mail.Factory[confirmation.CodeData],
 	emailer mail.Emailer,
 ) *ResendEmailConfirmationCommandHandler {
-	return &ResendEmailConfirmationCommandHandler{db: db, emailFactory: emailFactory, emailer: emailer}
+	return &ResendEmailConfirmationCommandHandler{
+		db:               db,
+		codes:            codes,
+		emailFactory:     emailFactory,
+		codeEmailFactory: codeEmailFactory,
+		emailer:          emailer,
+	}
 }
 
 func (h *ResendEmailConfirmationCommandHandler) Execute(cmd ResendEmailConfirmationCommand) error {
@@ -59,6 +84,9 @@ func (h *ResendEmailConfirmationCommandHandler) Execute(cmd ResendEmailConfirmat
 	if emailConfirmed {
 		return nil
 	}
+	if cmd.ConfirmationMethod == ConfirmationMethodCode {
+		return sendConfirmationCode(h.codes, h.codeEmailFactory, h.emailer, id, cmd.Email)
+	}
 	err = sendConfirmationToken(h.db, h.emailFactory, h.emailer, id, cmd.Email)
 	return err
 }
@@ -2,17 +2,23 @@ package signup
 
 import (
 	"database/sql"
+	"errors"
 	"github.com/labstack/echo/v4"
+	"net/http"
 	"sw/internal/cqrs"
 	"sw/internal/identity/crypto"
+	"sw/internal/identity/emailotp"
 	"sw/internal/identity/mail/confirmation"
+	"sw/internal/identity/passwordpolicy"
 	"sw/internal/mail"
 	"time"
 )
 
 type SignUpRequest struct {
 	Email    string `json:"email" validate:"required,max=320,email,not_exist"`
-	Password string `json:"password" validate:"required,min=8,max=64"`
+	Password string `json:"password" validate:"required,max=1024"`
+	// ConfirmationMethod picks a code to type instead of the link to follow, which suits mobile clients.
+	ConfirmationMethod string `json:"confirmation_method" validate:"omitempty,oneof=link code"`
 }
 
 func NewSignUpHandler(cmdHandler cqrs.CommandHandler[SignUpCommand]) echo.HandlerFunc {
@@ -26,33 +32,64 @@ func NewSignUpHandler(cmdHandler cqrs.CommandHandler[SignUpCommand]) echo.Handle
 		if err != nil {
 			return err
 		}
-		cmd := SignUpCommand{Email: request.Email, Password: request.Password}
-		return cmdHandler.Execute(cmd)
+		cmd := SignUpCommand{
+			Email:              request.Email,
+			Password:           request.Password,
+			ConfirmationMethod: request.ConfirmationMethod,
+		}
+		err = cmdHandler.Execute(cmd)
+		if err != nil {
+			var violationErr *passwordpolicy.ViolationError
+			if errors.As(err, &violationErr) {
+				return c.JSON(http.StatusBadRequest, passwordpolicy.MapViolationError("password", violationErr))
+			}
+			return err
+		}
+		return nil
 	}
 }
 
 type SignUpCommandHandler struct {
-	db           *sql.DB
-	hasher       crypto.Hasher
-	emailFactory mail.Factory[confirmation.Data]
-	emailer      mail.Emailer
+	db               *sql.DB
+	hasher           crypto.Hasher
+	policy           *passwordpolicy.Policy
+	codes            *emailotp.Codes
+	emailFactory     mail.Factory[confirmation.Data]
+	codeEmailFactory mail.Factory[confirmation.CodeData]
+	emailer          mail.Emailer
 }
 
 type SignUpCommand struct {
-	Email    string
-	Password string
+	Email              string
+	Password           string
+	ConfirmationMethod string
 }
 
 func NewSignUpCommandHandler(
 	db *sql.DB,
 	hasher crypto.Hasher,
+	policy *passwordpolicy.Policy,
+	codes *emailotp.Codes,
 	emailFactory mail.Factory[confirmation.Data],
+	codeEmailFactory mail.Factory[confirmation.CodeData],
 	emailer mail.Emailer,
 ) *SignUpCommandHandler {
-	return &SignUpCommandHandler{db: db, hasher: hasher, emailFactory: emailFactory, emailer: emailer}
+	return &SignUpCommandHandler{
+		db:               db,
+		hasher:           hasher,
+		policy:           policy,
+		codes:            codes,
+		emailFactory:     emailFactory,
+		codeEmailFactory: codeEmailFactory,
+		emailer:          emailer,
+	}
 }
 
 func (h *SignUpCommandHandler) Execute(cmd SignUpCommand) error {
+	err := h.policy.Enforce(cmd.Password, cmd.Email)
+	if err != nil {
+		return err
+	}
 	passwordHash, err := h.hasher.Hash(cmd.Password)
 	if err != nil {
 		return err
@@ -65,6 +102,9 @@ func (h *SignUpCommandHandler) Execute(cmd SignUpCommand) error {
 		return err
 	}
 
+	if cmd.ConfirmationMethod == ConfirmationMethodCode {
+		return sendConfirmationCode(h.codes, h.codeEmailFactory, h.emailer, id, cmd.Email)
+	}
 	err = sendConfirmationToken(h.db, h.emailFactory, h.emailer, id, cmd.Email)
 	return err
 }
@@ -0,0 +1,138 @@
+package twofactor
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/internal/apierr"
+	"sw/internal/cqrs"
+	"sw/internal/identity/crypto"
+	"sw/internal/identity/mail/recoverycodes"
+	"sw/internal/identity/mfa"
+	"sw/internal/mail"
+)
+
+const (
+	ErrMFANotEnabled = "ERR_MFA_NOT_ENABLED"
+)
+
+type RecoveryCodesRequest struct {
+	Password string `json:"password" validate:"required,max=1024"`
+}
+
+// NewRecoveryCodesHandler replaces the recovery codes, for when they run out or may have been seen.
+func NewRecoveryCodesHandler(
+	cmdHandler cqrs.CommandHandlerWithResponse[RecoveryCodesCommand, RecoveryCodesCommandResponse],
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request RecoveryCodesRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		claims := c.Get("claims").(jwt.MapClaims)
+		sub, err := claims.GetSubject()
+		if err != nil {
+			return err
+		}
+		cmd := RecoveryCodesCommand{AccountID: sub, Password: request.Password}
+		cmdResponse, err := cmdHandler.Execute(cmd)
+		if err != nil {
+			switch err {
+			case InvalidPasswordError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrInvalidPassword,
+					Message: "The password is invalid",
+				})
+			case NotEnabledError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrMFANotEnabled,
+					Message: "Two-factor authentication is not enabled",
+				})
+			}
+			return err
+		}
+		return c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: cmdResponse.RecoveryCodes})
+	}
+}
+
+type RecoveryCodesCommandHandler struct {
+	db           *sql.DB
+	hasher       crypto.Hasher
+	emailFactory mail.Factory[recoverycodes.Data]
+	emailer      mail.Emailer
+}
+
+type RecoveryCodesCommand struct {
+	AccountID string
+	Password  string
+}
+
+type RecoveryCodesCommandResponse struct {
+	RecoveryCodes []string
+}
+
+func NewRecoveryCodesCommandHandler(
+	db *sql.DB,
+	hasher crypto.Hasher,
+	emailFactory mail.Factory[recoverycodes.Data],
+	emailer mail.Emailer,
+) *RecoveryCodesCommandHandler {
+	return &RecoveryCodesCommandHandler{db: db, hasher: hasher, emailFactory: emailFactory, emailer: emailer}
+}
+
+// Execute lets the owner know by email, whoever holds a session and the password could otherwise
+// quietly take over the recovery of the account.
+func (h *RecoveryCodesCommandHandler) Execute(cmd RecoveryCodesCommand) (RecoveryCodesCommandResponse, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return RecoveryCodesCommandResponse{}, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT a.email, a.password_hash, t.activated_at IS NOT NULL
+				FROM account a LEFT JOIN account_totp t ON t.account_id = a.id
+				WHERE a.id = $1`
+	var email string
+	var passwordHash string
+	var enabled bool
+	err = tx.QueryRow(query, cmd.AccountID).Scan(&email, &passwordHash, &enabled)
+	if err != nil {
+		return RecoveryCodesCommandResponse{}, err
+	}
+	if !h.hasher.Match(passwordHash, cmd.Password) {
+		return RecoveryCodesCommandResponse{}, InvalidPasswordError
+	}
+	if !enabled {
+		return RecoveryCodesCommandResponse{}, NotEnabledError
+	}
+	codes, err := mfa.NewRecoveryCodes(tx, h.hasher, cmd.AccountID)
+	if err != nil {
+		return RecoveryCodesCommandResponse{}, err
+	}
+
+	// The email goes out before the commit, if it fails the previous codes are kept rather than
+	// replaced by ones the client never gets to see.
+	ctx := mail.Context[recoverycodes.Data]{To: email, Data: recoverycodes.Data{}}
+	e, err := h.emailFactory.Create(ctx)
+	if err != nil {
+		return RecoveryCodesCommandResponse{}, err
+	}
+	err = h.emailer.Send(e)
+	if err != nil {
+		return RecoveryCodesCommandResponse{}, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return RecoveryCodesCommandResponse{}, err
+	}
+	return RecoveryCodesCommandResponse{RecoveryCodes: codes}, nil
+}
+
+var NotEnabledError = errors.New("two-factor authentication is not enabled")
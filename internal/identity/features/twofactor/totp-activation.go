@@ -0,0 +1,118 @@
+package twofactor
+
+import (
+	"database/sql"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/internal/apierr"
+	"sw/internal/cqrs"
+	"sw/internal/identity/crypto"
+	"sw/internal/identity/mfa"
+	"time"
+)
+
+type TOTPActivationRequest struct {
+	Code string `json:"code" validate:"required,max=16"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// NewTOTPActivationHandler enables the pending authenticator app, proving it was set up correctly.
+// From then on signing in takes a code of it, or one of the recovery codes returned, which are
+// never shown again.
+func NewTOTPActivationHandler(
+	cmdHandler cqrs.CommandHandlerWithResponse[TOTPActivationCommand, TOTPActivationCommandResponse],
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request TOTPActivationRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		claims := c.Get("claims").(jwt.MapClaims)
+		sub, err := claims.GetSubject()
+		if err != nil {
+			return err
+		}
+		cmd := TOTPActivationCommand{AccountID: sub, Code: request.Code}
+		cmdResponse, err := cmdHandler.Execute(cmd)
+		if err != nil {
+			switch err {
+			case NoPendingEnrollmentError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrNoPendingEnrollment,
+					Message: "No authenticator app enrollment is pending",
+				})
+			case mfa.InvalidCodeError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrInvalidMFACode,
+					Message: "The code is invalid",
+				})
+			}
+			return err
+		}
+		return c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: cmdResponse.RecoveryCodes})
+	}
+}
+
+type TOTPActivationCommandHandler struct {
+	db     *sql.DB
+	hasher crypto.Hasher
+}
+
+type TOTPActivationCommand struct {
+	AccountID string
+	Code      string
+}
+
+type TOTPActivationCommandResponse struct {
+	RecoveryCodes []string
+}
+
+func NewTOTPActivationCommandHandler(db *sql.DB, hasher crypto.Hasher) *TOTPActivationCommandHandler {
+	return &TOTPActivationCommandHandler{db: db, hasher: hasher}
+}
+
+func (h *TOTPActivationCommandHandler) Execute(cmd TOTPActivationCommand) (TOTPActivationCommandResponse, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return TOTPActivationCommandResponse{}, err
+	}
+	defer tx.Rollback()
+
+	query := "SELECT secret FROM account_totp WHERE account_id = $1 AND activated_at IS NULL FOR UPDATE"
+	var secret string
+	err = tx.QueryRow(query, cmd.AccountID).Scan(&secret)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return TOTPActivationCommandResponse{}, NoPendingEnrollmentError
+		}
+		return TOTPActivationCommandResponse{}, err
+	}
+	now := time.Now()
+	step, ok := mfa.ValidateTOTP(secret, cmd.Code, now, 0)
+	if !ok {
+		return TOTPActivationCommandResponse{}, mfa.InvalidCodeError
+	}
+	query = "UPDATE account_totp SET activated_at = $1, last_used_step = $2 WHERE account_id = $3"
+	_, err = tx.Exec(query, now.UTC(), step, cmd.AccountID)
+	if err != nil {
+		return TOTPActivationCommandResponse{}, err
+	}
+	codes, err := mfa.NewRecoveryCodes(tx, h.hasher, cmd.AccountID)
+	if err != nil {
+		return TOTPActivationCommandResponse{}, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return TOTPActivationCommandResponse{}, err
+	}
+	return TOTPActivationCommandResponse{RecoveryCodes: codes}, nil
+}
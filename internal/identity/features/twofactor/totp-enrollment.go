@@ -0,0 +1,139 @@
+package twofactor
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/config"
+	"sw/internal/apierr"
+	"sw/internal/cqrs"
+	"sw/internal/identity/crypto"
+	"sw/internal/identity/mfa"
+	"time"
+)
+
+const (
+	ErrInvalidPassword     = "ERR_INVALID_PASSWORD"
+	ErrMFAAlreadyEnabled   = "ERR_MFA_ALREADY_ENABLED"
+	ErrNoPendingEnrollment = "ERR_NO_PENDING_MFA_ENROLLMENT"
+	ErrInvalidMFACode      = "ERR_INVALID_MFA_CODE"
+)
+
+type TOTPEnrollmentRequest struct {
+	Password string `json:"password" validate:"required,max=1024"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// NewTOTPEnrollmentHandler starts the enrollment of an authenticator app. The secret takes effect once
+// a code generated from it is submitted to the activation handler, a new enrollment before that
+// replaces the pending one.
+func NewTOTPEnrollmentHandler(
+	cmdHandler cqrs.CommandHandlerWithResponse[TOTPEnrollmentCommand, TOTPEnrollmentCommandResponse],
+) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var request TOTPEnrollmentRequest
+		err := c.Bind(&request)
+		if err != nil {
+			return err
+		}
+		err = c.Validate(request)
+		if err != nil {
+			return err
+		}
+		claims := c.Get("claims").(jwt.MapClaims)
+		sub, err := claims.GetSubject()
+		if err != nil {
+			return err
+		}
+		cmd := TOTPEnrollmentCommand{AccountID: sub, Password: request.Password}
+		cmdResponse, err := cmdHandler.Execute(cmd)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return c.NoContent(http.StatusUnauthorized)
+			case InvalidPasswordError:
+				return c.JSON(http.StatusBadRequest, apierr.ErrorResponse{
+					Code:    ErrInvalidPassword,
+					Message: "The password is invalid",
+				})
+			case AlreadyEnabledError:
+				return c.JSON(http.StatusConflict, apierr.ErrorResponse{
+					Code:    ErrMFAAlreadyEnabled,
+					Message: "An authenticator app is already enabled",
+				})
+			}
+			return err
+		}
+		return c.JSON(http.StatusOK, TOTPEnrollmentResponse{Secret: cmdResponse.Secret, URI: cmdResponse.URI})
+	}
+}
+
+type TOTPEnrollmentCommandHandler struct {
+	opt    config.MFAOptions
+	db     *sql.DB
+	hasher crypto.Hasher
+}
+
+type TOTPEnrollmentCommand struct {
+	AccountID string
+	Password  string
+}
+
+type TOTPEnrollmentCommandResponse struct {
+	Secret string
+	URI    string
+}
+
+func NewTOTPEnrollmentCommandHandler(
+	opt config.MFAOptions,
+	db *sql.DB,
+	hasher crypto.Hasher,
+) *TOTPEnrollmentCommandHandler {
+	return &TOTPEnrollmentCommandHandler{opt: opt, db: db, hasher: hasher}
+}
+
+func (h *TOTPEnrollmentCommandHandler) Execute(cmd TOTPEnrollmentCommand) (TOTPEnrollmentCommandResponse, error) {
+	query := "SELECT email, password_hash FROM account WHERE id = $1"
+	var email string
+	var passwordHash string
+	err := h.db.QueryRow(query, cmd.AccountID).Scan(&email, &passwordHash)
+	if err != nil {
+		return TOTPEnrollmentCommandResponse{}, err
+	}
+	if !h.hasher.Match(passwordHash, cmd.Password) {
+		return TOTPEnrollmentCommandResponse{}, InvalidPasswordError
+	}
+
+	secret, err := mfa.NewTOTPSecret()
+	if err != nil {
+		return TOTPEnrollmentCommandResponse{}, err
+	}
+	query = `INSERT INTO account_totp (account_id, secret, created_at) VALUES ($1, $2, $3)
+				ON CONFLICT (account_id) DO UPDATE SET secret = excluded.secret, created_at = excluded.created_at
+				WHERE account_totp.activated_at IS NULL`
+	result, err := h.db.Exec(query, cmd.AccountID, secret, time.Now().UTC())
+	if err != nil {
+		return TOTPEnrollmentCommandResponse{}, err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return TOTPEnrollmentCommandResponse{}, err
+	}
+	if count == 0 {
+		return TOTPEnrollmentCommandResponse{}, AlreadyEnabledError
+	}
+	uri := mfa.TOTPURI(h.opt.TOTPIssuer, email, secret)
+	return TOTPEnrollmentCommandResponse{Secret: secret, URI: uri}, nil
+}
+
+var (
+	InvalidPasswordError     = errors.New("password is invalid")
+	AlreadyEnabledError      = errors.New("authenticator app is already enabled")
+	NoPendingEnrollmentError = errors.New("no authenticator app enrollment is pending")
+)
@@ -0,0 +1,61 @@
+package userinfo
+
+import (
+	"database/sql"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/internal/cqrs"
+)
+
+type UserInfoResponse struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+func NewUserInfoHandler(queryHandler cqrs.QueryHandler[UserInfoQuery, UserInfo]) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		claims := c.Get("claims").(jwt.MapClaims)
+		sub, err := claims.GetSubject()
+		if err != nil {
+			return err
+		}
+		query := UserInfoQuery{AccountID: sub}
+		info, err := queryHandler.Execute(query)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.NoContent(http.StatusUnauthorized)
+			}
+			return err
+		}
+		response := UserInfoResponse{Subject: info.ID, Email: info.Email, EmailVerified: info.EmailConfirmed}
+		return c.JSON(http.StatusOK, response)
+	}
+}
+
+type UserInfoQueryHandler struct {
+	db *sql.DB
+}
+
+type UserInfoQuery struct {
+	AccountID string
+}
+
+type UserInfo struct {
+	ID             string
+	Email          string
+	EmailConfirmed bool
+}
+
+func NewUserInfoQueryHandler(db *sql.DB) *UserInfoQueryHandler {
+	return &UserInfoQueryHandler{db: db}
+}
+
+// Execute reads the claims from the account rather than the token, so changes made after sign-in show up.
+func (h *UserInfoQueryHandler) Execute(query UserInfoQuery) (UserInfo, error) {
+	sqlQuery := "SELECT id, email, email_confirmed FROM account WHERE id = $1"
+	var info UserInfo
+	err := h.db.QueryRow(sqlQuery, query.AccountID).Scan(&info.ID, &info.Email, &info.EmailConfirmed)
+	return info, err
+}
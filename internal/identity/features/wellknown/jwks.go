@@ -0,0 +1,26 @@
+package wellknown
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/internal/auth/keys"
+)
+
+// NewJWKSHandler publishes the public keys of the ring. With the shared secret fallback the set is empty,
+// tokens signed that way can only be verified by holders of the secret.
+func NewJWKSHandler(keyRing *keys.KeyRing) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		response := keys.JWKS{Keys: make([]keys.JWK, 0)}
+		for _, key := range keyRing.Published() {
+			jwk, err := key.JWK()
+			if err != nil {
+				if err == keys.SymmetricKeyError {
+					continue
+				}
+				return err
+			}
+			response.Keys = append(response.Keys, jwk)
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+}
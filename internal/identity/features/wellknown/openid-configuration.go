@@ -0,0 +1,66 @@
+package wellknown
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sw/config"
+	"sw/internal/auth/keys"
+)
+
+type OpenIDConfigurationResponse struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+func NewOpenIDConfigurationHandler(opt config.JwtOptions, keyRing *keys.KeyRing) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		algorithms := make([]string, 0)
+		seen := make(map[string]bool)
+		for _, key := range keyRing.Published() {
+			alg := key.Method.Alg()
+			if !seen[alg] {
+				seen[alg] = true
+				algorithms = append(algorithms, alg)
+			}
+		}
+		response := OpenIDConfigurationResponse{
+			Issuer:                      opt.Issuer,
+			AuthorizationEndpoint:       opt.Issuer + "/authorize",
+			TokenEndpoint:               opt.Issuer + "/token",
+			IntrospectionEndpoint:       opt.Issuer + "/introspect",
+			RevocationEndpoint:          opt.Issuer + "/revoke",
+			DeviceAuthorizationEndpoint: opt.Issuer + "/device/code",
+			JWKSURI:                     opt.Issuer + "/.well-known/jwks.json",
+			UserInfoEndpoint:            opt.Issuer + "/userinfo",
+			ResponseTypesSupported:      []string{"code"},
+			GrantTypesSupported: []string{
+				"authorization_code",
+				"client_credentials",
+				"urn:ietf:params:oauth:grant-type:device_code",
+			},
+			CodeChallengeMethodsSupported:     []string{"S256"},
+			TokenEndpointAuthMethodsSupported: []string{"none", "client_secret_basic", "client_secret_post"},
+			SubjectTypesSupported:             []string{"public"},
+			IDTokenSigningAlgValuesSupported:  algorithms,
+			ScopesSupported:                   []string{"openid", "email"},
+			ClaimsSupported: []string{
+				"iss", "aud", "sub", "exp", "iat", "auth_time", "nonce", "email", "email_verified",
+			},
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+}
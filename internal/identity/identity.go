@@ -6,15 +6,40 @@ import (
 	"github.com/labstack/echo/v4"
 	"sw/config"
 	"sw/internal/auth"
+	"sw/internal/auth/keys"
+	"sw/internal/identity/credentials"
 	"sw/internal/identity/crypto"
+	"sw/internal/identity/emailotp"
+	"sw/internal/identity/features/emailchange"
 	"sw/internal/identity/features/me"
+	"sw/internal/identity/features/oauth"
+	"sw/internal/identity/features/passkeys"
+	"sw/internal/identity/features/passwordreset"
+	"sw/internal/identity/features/refresh"
+	"sw/internal/identity/features/sessions"
 	"sw/internal/identity/features/signin"
+	"sw/internal/identity/features/signout"
 	"sw/internal/identity/features/signup"
+	"sw/internal/identity/features/twofactor"
+	"sw/internal/identity/features/userinfo"
+	"sw/internal/identity/features/wellknown"
 	"sw/internal/identity/infrastructure/postgresql"
 	"sw/internal/identity/mail/confirmation"
+	emailchangemail "sw/internal/identity/mail/emailchange"
+	"sw/internal/identity/mail/magiclink"
+	"sw/internal/identity/mail/passkeyadded"
+	"sw/internal/identity/mail/passwordchanged"
+	passwordresetmail "sw/internal/identity/mail/passwordreset"
+	"sw/internal/identity/mail/recoverycodes"
+	"sw/internal/identity/mail/signincode"
+	"sw/internal/identity/mfa"
+	"sw/internal/identity/passwordpolicy"
+	"sw/internal/identity/tokens"
 	"sw/internal/identity/validation"
+	"sw/internal/identity/webauthn"
 	"sw/internal/logging"
 	"sw/internal/mail"
+	"time"
 )
 
 func Initialize(
@@ -22,7 +47,7 @@ func Initialize(
 	logger logging.Logger,
 	validate *validator.Validate,
 	cfg config.Config,
-	secret []byte,
+	keyRing *keys.KeyRing,
 	db *sql.DB,
 	emailer mail.Emailer,
 ) error {
@@ -37,25 +62,193 @@ func Initialize(
 		return err
 	}
 
-	hasher := crypto.NewDefaultHasher()
+	hasher, err := crypto.NewHasher(cfg.PasswordHashing)
+	if err != nil {
+		return err
+	}
+	policy, err := passwordpolicy.New(cfg.PasswordPolicy, logger)
+	if err != nil {
+		return err
+	}
+	history := passwordpolicy.NewHistory(hasher, cfg.PasswordPolicy.HistorySize)
 	emailFactory := confirmation.NewFactory()
+	codeEmailFactory := confirmation.NewCodeFactory()
+	issuer := tokens.NewIssuer(cfg.JWT, keyRing)
+	verifier := credentials.NewVerifier(db, hasher, logger)
+	authenticator := mfa.NewAuthenticator(cfg.MFA, db, hasher)
+	relyingParty := webauthn.NewRelyingParty(cfg.WebAuthn)
+	emailCodes := emailotp.NewCodes(cfg.EmailOTP, db)
 
 	// SignUp
-	signUpCmdHandler := signup.NewSignUpCommandHandler(db, hasher, emailFactory, emailer)
-	resendEmailConfirmationCmdHandler := signup.NewResendEmailConfirmationCommandHandler(db, emailFactory, emailer)
+	signUpCmdHandler := signup.NewSignUpCommandHandler(
+		db,
+		hasher,
+		policy,
+		emailCodes,
+		emailFactory,
+		codeEmailFactory,
+		emailer,
+	)
+	resendEmailConfirmationCmdHandler := signup.NewResendEmailConfirmationCommandHandler(
+		db,
+		emailCodes,
+		emailFactory,
+		codeEmailFactory,
+		emailer,
+	)
 	emailConfirmationCmdHandler := signup.NewEmailConfirmationCommandHandler(db)
+	emailCodeConfirmationCmdHandler := signup.NewEmailCodeConfirmationCommandHandler(db, emailCodes)
 	// SignIn
-	signInCmdHandler := signin.NewSignInCommandHandler(cfg.JWT, secret, db, hasher)
+	signInCmdHandler := signin.NewSignInCommandHandler(cfg.MFA, issuer, db, verifier, authenticator)
+	mfaSignInCmdHandler := signin.NewMFASignInCommandHandler(cfg.MFA, issuer, db, authenticator)
+	passkeyOptionsCmdHandler := signin.NewPasskeyOptionsCommandHandler(db)
+	passkeySignInCmdHandler := signin.NewPasskeySignInCommandHandler(cfg.WebAuthn, issuer, db, relyingParty)
+	magicLinkCmdHandler := signin.NewMagicLinkCommandHandler(db, magiclink.NewFactory(), emailer)
+	magicLinkSignInCmdHandler := signin.NewMagicLinkSignInCommandHandler(cfg.MFA, issuer, db, authenticator)
+	emailCodeCmdHandler := signin.NewEmailCodeCommandHandler(db, emailCodes, signincode.NewFactory(), emailer)
+	emailCodeSignInCmdHandler := signin.NewEmailCodeSignInCommandHandler(cfg.MFA, issuer, db, emailCodes, authenticator)
+	refreshCmdHandler := refresh.NewRefreshCommandHandler(issuer, db, logger)
+	// Password reset
+	passwordResetEmailFactory := passwordresetmail.NewFactory()
+	passwordResetRequestCmdHandler := passwordreset.NewPasswordResetRequestCommandHandler(
+		db,
+		passwordResetEmailFactory,
+		emailer,
+	)
+	passwordResetConfirmCmdHandler := passwordreset.NewPasswordResetConfirmCommandHandler(
+		db,
+		hasher,
+		policy,
+		history,
+	)
+	// Me
+	passwordChangedEmailFactory := passwordchanged.NewFactory()
+	changePasswordCmdHandler := me.NewChangePasswordCommandHandler(
+		db,
+		hasher,
+		policy,
+		history,
+		passwordChangedEmailFactory,
+		emailer,
+		logger,
+	)
+	emailChangeCmdHandler := emailchange.NewEmailChangeCommandHandler(
+		db,
+		hasher,
+		emailchangemail.NewConfirmationFactory(),
+		emailchangemail.NewNotificationFactory(),
+		emailer,
+	)
+	emailChangeConfirmationCmdHandler := emailchange.NewEmailChangeConfirmationCommandHandler(db)
+	emailChangeCancellationCmdHandler := emailchange.NewEmailChangeCancellationCommandHandler(db)
+	// Two-factor authentication
+	totpEnrollmentCmdHandler := twofactor.NewTOTPEnrollmentCommandHandler(cfg.MFA, db, hasher)
+	totpActivationCmdHandler := twofactor.NewTOTPActivationCommandHandler(db, hasher)
+	recoveryCodesCmdHandler := twofactor.NewRecoveryCodesCommandHandler(
+		db,
+		hasher,
+		recoverycodes.NewFactory(),
+		emailer,
+	)
+	// Passkeys
+	passkeyRegistrationOptionsCmdHandler := passkeys.NewRegistrationOptionsCommandHandler(db, hasher, authenticator)
+	passkeyRegistrationCmdHandler := passkeys.NewRegistrationCommandHandler(
+		cfg.WebAuthn,
+		db,
+		relyingParty,
+		passkeyadded.NewFactory(),
+		emailer,
+	)
+	// SignOut
+	signOutCmdHandler := signout.NewSignOutCommandHandler(db)
+	signOutAllCmdHandler := signout.NewSignOutAllCommandHandler(db)
+	// Sessions
+	sessionsQueryHandler := sessions.NewSessionsQueryHandler(db)
+	revokeSessionCmdHandler := sessions.NewRevokeSessionCommandHandler(db)
+	// OpenID Connect
+	userInfoQueryHandler := userinfo.NewUserInfoQueryHandler(db)
+	// OAuth
+	clientQueryHandler := oauth.NewClientQueryHandler(db)
+	authorizeCmdHandler := oauth.NewAuthorizeCommandHandler(db, verifier, authenticator)
+	authorizationCodeCmdHandler := oauth.NewAuthorizationCodeCommandHandler(cfg, issuer, db, hasher)
+	clientCredentialsCmdHandler := oauth.NewClientCredentialsCommandHandler(cfg.JWT, issuer, db, hasher)
+	introspectionQueryHandler := oauth.NewIntrospectionQueryHandler(cfg.JWT, keyRing, db, hasher)
+	revocationCmdHandler := oauth.NewRevocationCommandHandler(db, hasher)
+	deviceAuthorizationCmdHandler := oauth.NewDeviceAuthorizationCommandHandler(cfg.OAuth, db, hasher)
+	deviceRequestQueryHandler := oauth.NewDeviceRequestQueryHandler(db)
+	deviceVerificationCmdHandler := oauth.NewDeviceVerificationCommandHandler(db)
+	deviceCodeCmdHandler := oauth.NewDeviceCodeCommandHandler(cfg, issuer, db, hasher)
 
+	e.GET("/.well-known/jwks.json", wellknown.NewJWKSHandler(keyRing))
+	e.GET("/.well-known/openid-configuration", wellknown.NewOpenIDConfigurationHandler(cfg.JWT, keyRing))
 	e.POST("/signup", signup.NewSignUpHandler(signUpCmdHandler))
 	e.POST("/resend-email-confirmation", signup.NewResendEmailConfirmationHandler(resendEmailConfirmationCmdHandler))
 	e.POST("/email-confirmation", signup.NewEmailConfirmationHandler(emailConfirmationCmdHandler))
+	e.POST("/email-confirmation/code", signup.NewEmailCodeConfirmationHandler(emailCodeConfirmationCmdHandler))
 	e.POST("/signin", signin.NewSignInHandler(signInCmdHandler))
+	e.POST("/signin/mfa", signin.NewMFASignInHandler(mfaSignInCmdHandler))
+	e.POST("/signin/passkey/options", signin.NewPasskeyOptionsHandler(cfg.WebAuthn, passkeyOptionsCmdHandler))
+	e.POST("/signin/passkey", signin.NewPasskeySignInHandler(passkeySignInCmdHandler))
+	e.POST("/signin/magic-link", signin.NewMagicLinkHandler(magicLinkCmdHandler))
+	e.POST("/signin/magic-link/redeem", signin.NewMagicLinkSignInHandler(magicLinkSignInCmdHandler))
+	e.POST("/signin/email-code", signin.NewEmailCodeHandler(emailCodeCmdHandler))
+	e.POST("/signin/email-code/verify", signin.NewEmailCodeSignInHandler(emailCodeSignInCmdHandler))
+	e.POST("/token/refresh", refresh.NewRefreshHandler(refreshCmdHandler))
+	e.POST("/password-reset/request", passwordreset.NewPasswordResetRequestHandler(passwordResetRequestCmdHandler))
+	e.POST("/password-reset/confirm", passwordreset.NewPasswordResetConfirmHandler(passwordResetConfirmCmdHandler))
+	e.POST("/signout", signout.NewSignOutHandler(signOutCmdHandler), auth.Authorization())
+	e.POST("/signout/all", signout.NewSignOutAllHandler(signOutAllCmdHandler), auth.Authorization())
+	e.GET("/sessions", sessions.NewSessionsHandler(sessionsQueryHandler), auth.Authorization())
+	e.DELETE("/sessions/:id", sessions.NewRevokeSessionHandler(revokeSessionCmdHandler), auth.Authorization())
 	e.GET("/me", me.NewMeHandler(), auth.Authorization())
+	e.POST("/me/password", me.NewChangePasswordHandler(changePasswordCmdHandler), auth.Authorization())
+	e.POST("/me/email", emailchange.NewEmailChangeHandler(emailChangeCmdHandler), auth.Authorization())
+	e.POST("/me/mfa/totp", twofactor.NewTOTPEnrollmentHandler(totpEnrollmentCmdHandler), auth.Authorization())
+	e.POST("/me/mfa/totp/activate", twofactor.NewTOTPActivationHandler(totpActivationCmdHandler), auth.Authorization())
+	e.POST("/me/mfa/recovery-codes", twofactor.NewRecoveryCodesHandler(recoveryCodesCmdHandler), auth.Authorization())
+	e.POST("/me/passkeys/options", passkeys.NewRegistrationOptionsHandler(
+		cfg.WebAuthn,
+		passkeyRegistrationOptionsCmdHandler,
+	), auth.Authorization())
+	e.POST("/me/passkeys", passkeys.NewRegistrationHandler(passkeyRegistrationCmdHandler), auth.Authorization())
+	e.POST("/email-change/confirm", emailchange.NewEmailChangeConfirmationHandler(emailChangeConfirmationCmdHandler))
+	e.POST("/email-change/cancel", emailchange.NewEmailChangeCancellationHandler(emailChangeCancellationCmdHandler))
+	e.GET("/authorize", oauth.NewAuthorizationRequestHandler(cfg.OAuth.LoginURL, clientQueryHandler))
+	e.POST("/authorize", oauth.NewAuthorizeHandler(authorizeCmdHandler))
+	e.POST("/token", oauth.NewTokenHandler(
+		authorizationCodeCmdHandler,
+		clientCredentialsCmdHandler,
+		deviceCodeCmdHandler,
+	))
+	e.POST("/device/code", oauth.NewDeviceAuthorizationHandler(cfg.OAuth, deviceAuthorizationCmdHandler))
+	e.GET("/device/verify", oauth.NewDeviceRequestHandler(deviceRequestQueryHandler), auth.Authorization())
+	e.POST("/device/verify", oauth.NewDeviceVerificationHandler(deviceVerificationCmdHandler), auth.Authorization())
+	e.POST("/introspect", oauth.NewIntrospectionHandler(introspectionQueryHandler))
+	e.POST("/revoke", oauth.NewRevocationHandler(revocationCmdHandler))
+	e.GET("/userinfo", userinfo.NewUserInfoHandler(userInfoQueryHandler), auth.Authorization())
+	e.POST("/userinfo", userinfo.NewUserInfoHandler(userInfoQueryHandler), auth.Authorization())
 
 	// Jobs
 	confirmationsCleaner := signup.NewConfirmationsCleaner(db, logger)
 	go confirmationsCleaner.Clean()
+	passwordResetsCleaner := passwordreset.NewPasswordResetsCleaner(db, logger)
+	go passwordResetsCleaner.Clean()
+	emailChangesCleaner := emailchange.NewEmailChangesCleaner(db, logger)
+	go emailChangesCleaner.Clean()
+	authorizationCodeLifetime := time.Second * time.Duration(cfg.OAuth.AuthorizationCodeLifetimeSeconds)
+	codesCleaner := oauth.NewCodesCleaner(db, logger, authorizationCodeLifetime)
+	go codesCleaner.Clean()
+	challengeLifetime := time.Second * time.Duration(cfg.MFA.ChallengeLifetimeSeconds)
+	challengesCleaner := signin.NewChallengesCleaner(db, logger, challengeLifetime)
+	go challengesCleaner.Clean()
+	magicLinksCleaner := signin.NewMagicLinksCleaner(db, logger)
+	go magicLinksCleaner.Clean()
+	emailCodeLifetime := time.Second * time.Duration(cfg.EmailOTP.CodeLifetimeSeconds)
+	emailCodesCleaner := emailotp.NewCodesCleaner(db, logger, emailCodeLifetime)
+	go emailCodesCleaner.Clean()
+	webAuthnChallengeLifetime := time.Second * time.Duration(cfg.WebAuthn.ChallengeLifetimeSeconds)
+	webAuthnChallengesCleaner := passkeys.NewChallengesCleaner(db, logger, webAuthnChallengeLifetime)
+	go webAuthnChallengesCleaner.Clean()
 
 	return nil
 }
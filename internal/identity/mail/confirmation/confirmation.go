@@ -18,3 +18,20 @@ func (f Factory) Create(ctx mail.Context[Data]) (mail.Email, error) {
 	body := "Follow the link to confirm your account: " + link
 	return mail.Email{To: ctx.To, Subject: subject, PlainText: body}, nil
 }
+
+// CodeData is sent in place of the link to clients where typing a code is easier, like mobile apps.
+type CodeData struct {
+	Code string
+}
+
+type CodeFactory struct{}
+
+func NewCodeFactory() *CodeFactory {
+	return &CodeFactory{}
+}
+
+func (f CodeFactory) Create(ctx mail.Context[CodeData]) (mail.Email, error) {
+	subject := "Email Confirmation"
+	body := "Enter the code to confirm your account: " + ctx.Data.Code
+	return mail.Email{To: ctx.To, Subject: subject, PlainText: body}, nil
+}
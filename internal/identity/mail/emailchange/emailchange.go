@@ -0,0 +1,41 @@
+package emailchange
+
+import "sw/internal/mail"
+
+type ConfirmationData struct {
+	ConfirmationToken string
+}
+
+// ConfirmationFactory creates the email sent to the new address.
+type ConfirmationFactory struct{}
+
+func NewConfirmationFactory() *ConfirmationFactory {
+	return &ConfirmationFactory{}
+}
+
+func (f ConfirmationFactory) Create(ctx mail.Context[ConfirmationData]) (mail.Email, error) {
+	subject := "Email Change Confirmation"
+	link := "https://my-frontend/email-change/confirm?token=" + ctx.Data.ConfirmationToken
+	body := "Follow the link to confirm your new email address: " + link
+	return mail.Email{To: ctx.To, Subject: subject, PlainText: body}, nil
+}
+
+type NotificationData struct {
+	NewEmail    string
+	CancelToken string
+}
+
+// NotificationFactory creates the email sent to the current address.
+type NotificationFactory struct{}
+
+func NewNotificationFactory() *NotificationFactory {
+	return &NotificationFactory{}
+}
+
+func (f NotificationFactory) Create(ctx mail.Context[NotificationData]) (mail.Email, error) {
+	subject := "Your email address is being changed"
+	link := "https://my-frontend/email-change/cancel?token=" + ctx.Data.CancelToken
+	body := "A change of your account email address to " + ctx.Data.NewEmail + " has been requested. " +
+		"If it wasn't you, follow the link to cancel it: " + link
+	return mail.Email{To: ctx.To, Subject: subject, PlainText: body}, nil
+}
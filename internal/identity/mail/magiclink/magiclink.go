@@ -0,0 +1,22 @@
+package magiclink
+
+import "sw/internal/mail"
+
+type Data struct {
+	Token string
+}
+
+type Factory struct{}
+
+func NewFactory() *Factory {
+	return &Factory{}
+}
+
+func (f Factory) Create(ctx mail.Context[Data]) (mail.Email, error) {
+	subject := "Sign In Link"
+	link := "https://my-frontend/signin/magic-link?token=" + ctx.Data.Token
+	body := "Follow the link to sign in: " + link +
+		"\nThe link can be used once and expires shortly." +
+		"\nIf you didn't ask to sign in, you can ignore this email."
+	return mail.Email{To: ctx.To, Subject: subject, PlainText: body}, nil
+}
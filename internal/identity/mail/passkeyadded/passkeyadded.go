@@ -0,0 +1,21 @@
+package passkeyadded
+
+import "sw/internal/mail"
+
+type Data struct {
+	Name string
+}
+
+type Factory struct{}
+
+func NewFactory() *Factory {
+	return &Factory{}
+}
+
+func (f Factory) Create(ctx mail.Context[Data]) (mail.Email, error) {
+	subject := "A passkey has been added"
+	link := "https://my-frontend/password-reset"
+	body := "The passkey \"" + ctx.Data.Name + "\" has just been added to your account, it signs in without " +
+		"the password. If it wasn't you, reset your password: " + link
+	return mail.Email{To: ctx.To, Subject: subject, PlainText: body}, nil
+}
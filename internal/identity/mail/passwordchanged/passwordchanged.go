@@ -0,0 +1,18 @@
+package passwordchanged
+
+import "sw/internal/mail"
+
+type Data struct{}
+
+type Factory struct{}
+
+func NewFactory() *Factory {
+	return &Factory{}
+}
+
+func (f Factory) Create(ctx mail.Context[Data]) (mail.Email, error) {
+	subject := "Your password has been changed"
+	link := "https://my-frontend/password-reset"
+	body := "The password of your account has just been changed. If it wasn't you, reset your password: " + link
+	return mail.Email{To: ctx.To, Subject: subject, PlainText: body}, nil
+}
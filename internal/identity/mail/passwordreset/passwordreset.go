@@ -0,0 +1,21 @@
+package passwordreset
+
+import "sw/internal/mail"
+
+type Data struct {
+	ResetToken string
+}
+
+type Factory struct{}
+
+func NewFactory() *Factory {
+	return &Factory{}
+}
+
+func (f Factory) Create(ctx mail.Context[Data]) (mail.Email, error) {
+	subject := "Password Reset"
+	link := "https://my-frontend/password-reset?token=" + ctx.Data.ResetToken
+	body := "Follow the link to choose a new password: " + link +
+		"\nIf you didn't ask to reset your password, you can ignore this email."
+	return mail.Email{To: ctx.To, Subject: subject, PlainText: body}, nil
+}
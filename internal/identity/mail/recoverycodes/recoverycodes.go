@@ -0,0 +1,19 @@
+package recoverycodes
+
+import "sw/internal/mail"
+
+type Data struct{}
+
+type Factory struct{}
+
+func NewFactory() *Factory {
+	return &Factory{}
+}
+
+func (f Factory) Create(ctx mail.Context[Data]) (mail.Email, error) {
+	subject := "New recovery codes have been generated"
+	link := "https://my-frontend/password-reset"
+	body := "New recovery codes for two-factor authentication have just been generated for your account, " +
+		"the previous ones no longer work. If it wasn't you, reset your password: " + link
+	return mail.Email{To: ctx.To, Subject: subject, PlainText: body}, nil
+}
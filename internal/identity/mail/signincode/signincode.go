@@ -0,0 +1,20 @@
+package signincode
+
+import "sw/internal/mail"
+
+type Data struct {
+	Code string
+}
+
+type Factory struct{}
+
+func NewFactory() *Factory {
+	return &Factory{}
+}
+
+func (f Factory) Create(ctx mail.Context[Data]) (mail.Email, error) {
+	subject := "Sign In Code"
+	body := "Enter the code to sign in: " + ctx.Data.Code +
+		"\nIf you didn't ask to sign in, you can ignore this email."
+	return mail.Email{To: ctx.To, Subject: subject, PlainText: body}, nil
+}
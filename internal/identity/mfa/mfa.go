@@ -0,0 +1,170 @@
+package mfa
+
+import (
+	"database/sql"
+	"errors"
+	"sw/config"
+	"sw/internal/identity/crypto"
+	"time"
+)
+
+// Authenticator checks the second factors of accounts which enabled any.
+type Authenticator struct {
+	opt    config.MFAOptions
+	db     *sql.DB
+	hasher crypto.Hasher
+}
+
+func NewAuthenticator(opt config.MFAOptions, db *sql.DB, hasher crypto.Hasher) *Authenticator {
+	return &Authenticator{opt: opt, db: db, hasher: hasher}
+}
+
+// Required tells whether signing in to the account takes a second factor.
+func (a *Authenticator) Required(accountID string) (bool, error) {
+	query := "SELECT EXISTS (SELECT 1 FROM account_totp WHERE account_id = $1 AND activated_at IS NOT NULL)"
+	var required bool
+	err := a.db.QueryRow(query, accountID).Scan(&required)
+	return required, err
+}
+
+// Verify checks a code of the authenticator app of the account, or one of its recovery codes, which
+// are told apart by their format. Every path to a second factor comes here, so the wrong codes are
+// counted for the account, and after too many in a row none is checked until the lockout ends.
+func (a *Authenticator) Verify(accountID string, code string) error {
+	// The attempt is counted before the code is checked, so concurrent guesses can't exceed the limit.
+	now := time.Now().UTC()
+	query := `UPDATE account_totp
+				SET failed_attempts = CASE WHEN locked_until IS NULL THEN failed_attempts + 1 ELSE 1 END,
+					locked_until = NULL
+				WHERE account_id = $1 AND activated_at IS NOT NULL AND (locked_until IS NULL OR locked_until <= $2)
+				RETURNING failed_attempts`
+	var attempts int
+	err := a.db.QueryRow(query, accountID, now).Scan(&attempts)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return a.lockedOrInvalid(accountID)
+		}
+		return err
+	}
+	if attempts > a.opt.MaxFailures {
+		return LockedError
+	}
+
+	if isTOTPCode(code) {
+		err = a.verifyTOTP(accountID, code)
+	} else {
+		err = a.verifyRecoveryCode(accountID, code)
+	}
+	if err == nil {
+		query = "UPDATE account_totp SET failed_attempts = 0 WHERE account_id = $1"
+		_, err = a.db.Exec(query, accountID)
+		return err
+	}
+	if err != InvalidCodeError || attempts < a.opt.MaxFailures {
+		return err
+	}
+	query = "UPDATE account_totp SET locked_until = $1 WHERE account_id = $2"
+	_, err = a.db.Exec(query, now.Add(time.Duration(a.opt.LockoutSeconds)*time.Second), accountID)
+	if err != nil {
+		return err
+	}
+	return LockedError
+}
+
+// lockedOrInvalid tells a locked out account from one without a second factor, for which no code is valid.
+func (a *Authenticator) lockedOrInvalid(accountID string) error {
+	query := "SELECT EXISTS (SELECT 1 FROM account_totp WHERE account_id = $1 AND activated_at IS NOT NULL)"
+	var enabled bool
+	err := a.db.QueryRow(query, accountID).Scan(&enabled)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		return LockedError
+	}
+	return InvalidCodeError
+}
+
+// verifyTOTP accepts a code once, the step it belongs to is stored so the same or an earlier code
+// fails afterward.
+func (a *Authenticator) verifyTOTP(accountID string, code string) error {
+	query := "SELECT secret, last_used_step FROM account_totp WHERE account_id = $1 AND activated_at IS NOT NULL"
+	var secret string
+	var lastStep int64
+	err := a.db.QueryRow(query, accountID).Scan(&secret, &lastStep)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return InvalidCodeError
+		}
+		return err
+	}
+	step, ok := ValidateTOTP(secret, code, time.Now(), lastStep)
+	if !ok {
+		return InvalidCodeError
+	}
+	// Two requests with the same code race here, only the first one moves the step forward.
+	query = "UPDATE account_totp SET last_used_step = $1 WHERE account_id = $2 AND last_used_step < $1"
+	result, err := a.db.Exec(query, step, accountID)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return InvalidCodeError
+	}
+	return nil
+}
+
+// verifyRecoveryCode uses up the matching code. Codes only work while the authenticator app is enabled.
+func (a *Authenticator) verifyRecoveryCode(accountID string, code string) error {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT r.id, r.code_hash FROM mfa_recovery_code r
+				JOIN account_totp t ON t.account_id = r.account_id AND t.activated_at IS NOT NULL
+				WHERE r.account_id = $1 AND r.used_at IS NULL
+				FOR UPDATE OF r`
+	rows, err := tx.Query(query, accountID)
+	if err != nil {
+		return err
+	}
+	code = normalizeRecoveryCode(code)
+	var matched int64
+	for rows.Next() {
+		var id int64
+		var codeHash string
+		err = rows.Scan(&id, &codeHash)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if matched == 0 && a.hasher.Match(codeHash, code) {
+			matched = id
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if matched == 0 {
+		return InvalidCodeError
+	}
+	query = "UPDATE mfa_recovery_code SET used_at = $1 WHERE id = $2"
+	_, err = tx.Exec(query, time.Now().UTC(), matched)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+var (
+	RequiredError    = errors.New("second factor is required")
+	InvalidCodeError = errors.New("code is invalid")
+	LockedError      = errors.New("second factor is locked after too many wrong codes")
+)
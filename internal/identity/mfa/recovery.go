@@ -0,0 +1,53 @@
+package mfa
+
+import (
+	"database/sql"
+	"strings"
+	"sw/internal/identity/crypto"
+	"sw/internal/random"
+	"time"
+)
+
+const (
+	recoveryCodeCount = 10
+	// recoveryCodeAlphabet leaves out characters easily mistaken for one another.
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	recoveryCodeLength   = 10
+)
+
+// NewRecoveryCodes replaces the recovery codes of the account. The codes are returned once, formatted
+// for reading, and only their hashes are kept.
+func NewRecoveryCodes(tx *sql.Tx, hasher crypto.Hasher, accountID string) ([]string, error) {
+	query := "DELETE FROM mfa_recovery_code WHERE account_id = $1"
+	_, err := tx.Exec(query, accountID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	codes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code := random.Code(recoveryCodeLength, recoveryCodeAlphabet)
+		codeHash, err := hasher.Hash(code)
+		if err != nil {
+			return nil, err
+		}
+		query = "INSERT INTO mfa_recovery_code (code_hash, created_at, account_id) VALUES ($1, $2, $3)"
+		_, err = tx.Exec(query, codeHash, now, accountID)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:recoveryCodeLength/2]+"-"+code[recoveryCodeLength/2:])
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode accepts a code typed without the dash, with spaces, or in capitals.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
@@ -0,0 +1,245 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sw/config"
+	"time"
+)
+
+const (
+	BreachModeRange = "range"
+	BreachModeFile  = "file"
+)
+
+// defaultRangeTimeout applies when none is configured, the check runs while a password is being set
+// and must not hold it up for long.
+const defaultRangeTimeout = 3 * time.Second
+
+// rangePrefixLength is the number of hex characters of the hash sent to the range API,
+// the rest of it never leaves the server.
+const rangePrefixLength = 5
+
+// BreachChecker tells whether a password appeared in a known data breach at least minCount times.
+type BreachChecker interface {
+	Breached(password string) (bool, error)
+}
+
+// NewBreachChecker builds the checker of the configured mode, or nil when the check is disabled.
+func NewBreachChecker(opt config.BreachedPasswordsOptions) (BreachChecker, error) {
+	minCount := max(opt.MinCount, 1)
+	switch opt.Mode {
+	case "":
+		return nil, nil
+	case BreachModeRange:
+		timeout := time.Duration(opt.TimeoutSeconds) * time.Second
+		return NewRangeChecker(opt.RangeURL, timeout, minCount), nil
+	case BreachModeFile:
+		return OpenFileChecker(opt.FilePath, minCount)
+	}
+	return nil, fmt.Errorf("unsupported breached passwords mode: %q", opt.Mode)
+}
+
+// RangeChecker queries a k-anonymity range API. Only the first five characters of the SHA-1 of the
+// password are sent, the response lists the suffixes of all breached hashes with that prefix:
+//
+//	GET {baseURL}/range/5BAA6
+//	1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493
+type RangeChecker struct {
+	baseURL  string
+	client   *http.Client
+	minCount int
+}
+
+func NewRangeChecker(baseURL string, timeout time.Duration, minCount int) *RangeChecker {
+	if timeout <= 0 {
+		timeout = defaultRangeTimeout
+	}
+	return &RangeChecker{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		client:   &http.Client{Timeout: timeout},
+		minCount: minCount,
+	}
+}
+
+func (c *RangeChecker) Breached(password string) (bool, error) {
+	hash := sha1Hex(password)
+	prefix, suffix := hash[:rangePrefixLength], hash[rangePrefixLength:]
+	req, err := http.NewRequest(http.MethodGet, c.baseURL+"/range/"+prefix, nil)
+	if err != nil {
+		return false, err
+	}
+	// Padding hides the real number of suffixes, the padded ones come with a count of 0.
+	req.Header.Set("Add-Padding", "true")
+	req.Header.Set("User-Agent", "sw")
+	res, err := c.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return false, fmt.Errorf("range api responded with %s", res.Status)
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		s, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(s, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return false, err
+		}
+		return n >= c.minCount, nil
+	}
+	return false, scanner.Err()
+}
+
+// FileChecker looks passwords up offline in a file of hex encoded SHA-1 hashes sorted ascending,
+// as produced by the range API downloaders. The file is binary searched where it lies, a full
+// corpus takes tens of gigabytes, and read concurrently by offset.
+type FileChecker struct {
+	file     *os.File
+	size     int64
+	minCount int
+}
+
+// OpenFileChecker opens the file and checks its first line, the order of the rest is taken on trust.
+// Hashes seen fewer than minCount times pass, lines without a count always match, so a file of bare
+// hashes is a plain block list.
+func OpenFileChecker(path string, minCount int) (*FileChecker, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	c := &FileChecker{file: file, size: info.Size(), minCount: minCount}
+	line, err := c.lineFrom(0)
+	if err != nil && err != io.EOF {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err == nil {
+		if _, _, err = parseHashLine(line); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return c, nil
+}
+
+func (c *FileChecker) Breached(password string) (bool, error) {
+	hash := sha1Hex(password)
+	// The smallest offset whose next line holds a hash not below the one looked for.
+	lo, hi := int64(0), c.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		line, err := c.lineFrom(mid)
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		below := false
+		if err == nil {
+			h, _, err := parseHashLine(line)
+			if err != nil {
+				return false, err
+			}
+			below = h < hash
+		}
+		if below {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	line, err := c.lineFrom(lo)
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	h, count, err := parseHashLine(line)
+	if err != nil || h != hash {
+		return false, err
+	}
+	return count < 0 || count >= c.minCount, nil
+}
+
+// maxHashLineLength bounds a line, a hash, a colon and a count fit in far less.
+const maxHashLineLength = 128
+
+// lineFrom reads the first line starting at the offset or after it, io.EOF when there is none.
+func (c *FileChecker) lineFrom(offset int64) (string, error) {
+	start := offset
+	if offset > 0 {
+		// A line starts at the offset only when the previous byte ends a line.
+		start = offset - 1
+	}
+	buf := make([]byte, 2*maxHashLineLength)
+	n, err := c.file.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	buf = buf[:n]
+	if offset > 0 {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			if n < len(buf) {
+				return "", io.EOF
+			}
+			return "", InvalidHashFileError
+		}
+		buf = buf[i+1:]
+	}
+	if len(buf) == 0 {
+		return "", io.EOF
+	}
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		buf = buf[:i]
+	} else if n == 2*maxHashLineLength {
+		return "", InvalidHashFileError
+	}
+	return string(buf), nil
+}
+
+// parseHashLine returns the hash in upper case and the count, -1 when the line has none.
+func parseHashLine(line string) (string, int, error) {
+	h, count, ok := strings.Cut(strings.TrimSpace(line), ":")
+	if len(h) != 2*sha1.Size {
+		return "", 0, InvalidHashFileError
+	}
+	if _, err := hex.DecodeString(h); err != nil {
+		return "", 0, InvalidHashFileError
+	}
+	if !ok {
+		return strings.ToUpper(h), -1, nil
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return "", 0, InvalidHashFileError
+	}
+	return strings.ToUpper(h), n, nil
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+var InvalidHashFileError = errors.New("line is not a SHA-1 hash")
@@ -0,0 +1,68 @@
+package passwordpolicy
+
+import (
+	"database/sql"
+	"strconv"
+	"sw/internal/identity/crypto"
+	"time"
+)
+
+const RuleReused = "reused"
+
+// History keeps the hashes of the passwords an account had before, so the last ones are not chosen again.
+type History struct {
+	hasher crypto.Hasher
+	size   int
+}
+
+func NewHistory(hasher crypto.Hasher, size int) *History {
+	return &History{hasher: hasher, size: size}
+}
+
+// Check returns a ViolationError if the password is the current one or one of the previous ones
+// within the history size.
+func (h *History) Check(tx *sql.Tx, accountID string, currentHash string, password string) error {
+	if h.size == 0 {
+		return nil
+	}
+	violation := &ViolationError{Violations: []Violation{{Rule: RuleReused, Parameter: strconv.Itoa(h.size)}}}
+	if h.hasher.Match(currentHash, password) {
+		return violation
+	}
+	query := `SELECT password_hash FROM password_history WHERE account_id = $1
+				ORDER BY created_at DESC, id DESC LIMIT $2`
+	rows, err := tx.Query(query, accountID, h.size-1)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var passwordHash string
+		err = rows.Scan(&passwordHash)
+		if err != nil {
+			return err
+		}
+		if h.hasher.Match(passwordHash, password) {
+			return violation
+		}
+	}
+	return rows.Err()
+}
+
+// Record adds the hash of the password being replaced and forgets the ones no longer checked.
+func (h *History) Record(tx *sql.Tx, accountID string, previousHash string) error {
+	if h.size == 0 {
+		return nil
+	}
+	query := "INSERT INTO password_history VALUES (DEFAULT, $1, $2, $3)"
+	_, err := tx.Exec(query, accountID, previousHash, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	query = `DELETE FROM password_history WHERE account_id = $1 AND id NOT IN (
+				SELECT id FROM password_history WHERE account_id = $1
+				ORDER BY created_at DESC, id DESC LIMIT $2
+			)`
+	_, err = tx.Exec(query, accountID, h.size-1)
+	return err
+}
@@ -0,0 +1,227 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sw/config"
+	"sw/internal/apierr"
+	"sw/internal/logging"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	RuleMinLength   = "min_length"
+	RuleMaxLength   = "max_length"
+	RuleLowercase   = "lowercase"
+	RuleUppercase   = "uppercase"
+	RuleDigit       = "digit"
+	RuleSymbol      = "symbol"
+	RuleBanned      = "banned"
+	RuleEmail       = "similar_to_email"
+	RuleMinStrength = "min_strength"
+	RuleBreached    = "breached"
+)
+
+// minEmailPartLength keeps short local parts like "jo" from banning every password containing them.
+const minEmailPartLength = 3
+
+// Violation is a rule a password failed, with the parameter of the rule if it has one.
+type Violation struct {
+	Rule      string
+	Parameter string
+}
+
+type Policy struct {
+	opt    config.PasswordPolicyOptions
+	banned map[string]struct{}
+	breach BreachChecker
+	logger logging.Logger
+}
+
+// New builds the policy, reading the banned passwords file and setting up the breach check when configured.
+func New(opt config.PasswordPolicyOptions, logger logging.Logger) (*Policy, error) {
+	breach, err := NewBreachChecker(opt.BreachedPasswords)
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{
+		opt:    opt,
+		banned: make(map[string]struct{}, len(opt.BannedPasswords)),
+		breach: breach,
+		logger: logger,
+	}
+	for _, password := range opt.BannedPasswords {
+		p.banned[strings.ToLower(password)] = struct{}{}
+	}
+	if opt.BannedPasswordsPath == "" {
+		return p, nil
+	}
+	file, err := os.Open(opt.BannedPasswordsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		password := strings.TrimSpace(scanner.Text())
+		if password != "" {
+			p.banned[strings.ToLower(password)] = struct{}{}
+		}
+	}
+	return p, scanner.Err()
+}
+
+// Check returns every rule the password of the account with the given email fails.
+func (p *Policy) Check(password string, email string) []Violation {
+	violations := make([]Violation, 0)
+	length := utf8.RuneCountInString(password)
+	if length < p.opt.MinLength {
+		violations = append(violations, Violation{Rule: RuleMinLength, Parameter: strconv.Itoa(p.opt.MinLength)})
+	}
+	if p.opt.MaxLength > 0 && length > p.opt.MaxLength {
+		violations = append(violations, Violation{Rule: RuleMaxLength, Parameter: strconv.Itoa(p.opt.MaxLength)})
+	}
+
+	classes := classify(password)
+	if p.opt.RequireLowercase && !classes.lower {
+		violations = append(violations, Violation{Rule: RuleLowercase})
+	}
+	if p.opt.RequireUppercase && !classes.upper {
+		violations = append(violations, Violation{Rule: RuleUppercase})
+	}
+	if p.opt.RequireDigit && !classes.digit {
+		violations = append(violations, Violation{Rule: RuleDigit})
+	}
+	if p.opt.RequireSymbol && !classes.symbol {
+		violations = append(violations, Violation{Rule: RuleSymbol})
+	}
+
+	lower := strings.ToLower(password)
+	if _, ok := p.banned[lower]; ok {
+		violations = append(violations, Violation{Rule: RuleBanned})
+	}
+	if p.opt.RejectSimilarToEmail && similar(lower, strings.ToLower(email)) {
+		violations = append(violations, Violation{Rule: RuleEmail})
+	}
+	if p.opt.MinStrengthBits > 0 && Strength(password) < p.opt.MinStrengthBits {
+		violations = append(violations, Violation{
+			Rule:      RuleMinStrength,
+			Parameter: strconv.FormatFloat(p.opt.MinStrengthBits, 'f', -1, 64),
+		})
+	}
+	return violations
+}
+
+// Enforce returns a ViolationError if the password fails any rule or appeared in a breach. When the
+// breach check fails the password is accepted, an outage of the range API should not block sign-ups.
+func (p *Policy) Enforce(password string, email string) error {
+	violations := p.Check(password, email)
+	if p.breach != nil {
+		breached, err := p.breach.Breached(password)
+		if err != nil {
+			p.logger.Println("Breached password check failed:", err)
+		}
+		if breached {
+			violations = append(violations, Violation{Rule: RuleBreached})
+		}
+	}
+	if len(violations) > 0 {
+		return &ViolationError{Violations: violations}
+	}
+	return nil
+}
+
+// Strength estimates the entropy of the password in bits from the size of the character classes
+// it uses. Characters repeating or continuing a sequence of the previous one, as in "aaa" or "123",
+// add nothing.
+func Strength(password string) float64 {
+	classes := classify(password)
+	pool := 0
+	if classes.lower {
+		pool += 26
+	}
+	if classes.upper {
+		pool += 26
+	}
+	if classes.digit {
+		pool += 10
+	}
+	if classes.symbol {
+		pool += 33
+	}
+	if pool == 0 {
+		return 0
+	}
+	effective := 0
+	previous := rune(-1)
+	for _, r := range password {
+		d := r - previous
+		if previous < 0 || (d != 0 && d != 1 && d != -1) {
+			effective++
+		}
+		previous = r
+	}
+	return float64(effective) * math.Log2(float64(pool))
+}
+
+type characterClasses struct {
+	lower  bool
+	upper  bool
+	digit  bool
+	symbol bool
+}
+
+func classify(password string) characterClasses {
+	var classes characterClasses
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			classes.lower = true
+		case unicode.IsUpper(r):
+			classes.upper = true
+		case unicode.IsDigit(r):
+			classes.digit = true
+		default:
+			classes.symbol = true
+		}
+	}
+	return classes
+}
+
+func similar(password string, email string) bool {
+	local, _, _ := strings.Cut(email, "@")
+	if len(local) < minEmailPartLength {
+		return password == email
+	}
+	return strings.Contains(password, local) || strings.Contains(email, password)
+}
+
+// ViolationError reports the rules a new password failed.
+type ViolationError struct {
+	Violations []Violation
+}
+
+func (e *ViolationError) Error() string {
+	rules := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return "password violates the policy: " + strings.Join(rules, ", ")
+}
+
+// MapViolationError describes the failed rules as errors of the request field at the given path.
+func MapViolationError(path string, err *ViolationError) apierr.ValidationErrorResponse {
+	fields := make([]apierr.FieldError, 0, len(err.Violations))
+	for _, v := range err.Violations {
+		fields = append(fields, apierr.FieldError{Path: path, Validator: v.Rule, Parameter: v.Parameter})
+	}
+	return apierr.ValidationErrorResponse{
+		Code:    apierr.ErrValidationFailed,
+		Message: "The password does not satisfy the password policy",
+		Fields:  fields,
+	}
+}
@@ -0,0 +1,188 @@
+package tokens
+
+import (
+	"database/sql"
+	"github.com/golang-jwt/jwt/v5"
+	"strings"
+	"sw/config"
+	"sw/internal/auth"
+	"sw/internal/auth/keys"
+	"sw/internal/random"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxUserAgentLength = 512
+	maxIPLength        = 45
+)
+
+type Execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+type Issuer struct {
+	opt     config.JwtOptions
+	keyRing *keys.KeyRing
+}
+
+func NewIssuer(opt config.JwtOptions, keyRing *keys.KeyRing) *Issuer {
+	return &Issuer{opt: opt, keyRing: keyRing}
+}
+
+func (i *Issuer) AccessToken(id string, email string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   i.opt.Issuer,
+		"aud":   i.opt.Audience,
+		"sub":   id,
+		"exp":   now.Add(time.Minute * time.Duration(i.opt.AccessTokenLifetimeMinutes)).Unix(),
+		"iat":   now.Unix(),
+		"email": email,
+	}
+	return i.sign(auth.TypeAccessToken, claims)
+}
+
+// ClientAccessToken is issued to a client acting on its own behalf, there is no account behind it.
+func (i *Issuer) ClientAccessToken(clientID string, scope string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":       i.opt.Issuer,
+		"aud":       i.opt.Audience,
+		"sub":       clientID,
+		"exp":       now.Add(time.Minute * time.Duration(i.opt.ClientAccessTokenLifetimeMinutes)).Unix(),
+		"iat":       now.Unix(),
+		"client_id": clientID,
+		"scope":     scope,
+	}
+	return i.sign(auth.TypeAccessToken, claims)
+}
+
+// IDToken describes the authentication of an account to the client, the audience of the token.
+type IDToken struct {
+	Subject       string
+	Audience      string
+	Email         string
+	EmailVerified bool
+	Nonce         string
+	AuthTime      time.Time
+}
+
+func (i *Issuer) IDToken(t IDToken) (string, error) {
+	now := time.Now()
+	audience := t.Audience
+	if audience == "" {
+		audience = i.opt.Audience
+	}
+	claims := jwt.MapClaims{
+		"iss":            i.opt.Issuer,
+		"aud":            audience,
+		"sub":            t.Subject,
+		"exp":            now.Add(time.Minute * time.Duration(i.opt.AccessTokenLifetimeMinutes)).Unix(),
+		"iat":            now.Unix(),
+		"auth_time":      t.AuthTime.Unix(),
+		"email":          t.Email,
+		"email_verified": t.EmailVerified,
+	}
+	if t.Nonce != "" {
+		claims["nonce"] = t.Nonce
+	}
+	return i.sign(auth.TypeIDToken, claims)
+}
+
+func (i *Issuer) sign(typ string, claims jwt.MapClaims) (string, error) {
+	key, err := i.keyRing.Signing()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["typ"] = typ
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	return token.SignedString(key.Private)
+}
+
+// Origin describes the client a refresh token was issued to. ClientID is the OAuth client, empty for
+// sign-ins on the frontend itself.
+type Origin struct {
+	UserAgent string
+	IP        string
+	ClientID  string
+}
+
+// RefreshToken starts a new token family, one per sign-in.
+func (i *Issuer) RefreshToken(db Execer, accountID string, origin Origin) (string, error) {
+	family := random.Secret(32)
+	return i.insertRefreshToken(db, accountID, family, nil, origin)
+}
+
+// RotateRefreshToken issues the successor of the parent token within the same family.
+func (i *Issuer) RotateRefreshToken(
+	db Execer,
+	accountID string,
+	family string,
+	parentID int64,
+	origin Origin,
+) (string, error) {
+	return i.insertRefreshToken(db, accountID, family, &parentID, origin)
+}
+
+func (i *Issuer) insertRefreshToken(
+	db Execer,
+	accountID string,
+	family string,
+	parentID *int64,
+	origin Origin,
+) (string, error) {
+	refreshToken := random.Secret(32)
+	now := time.Now().UTC()
+	expiresAt := now.AddDate(0, 0, i.opt.RefreshTokenLifetimeDays)
+	query := `INSERT INTO refresh_token
+				(value, expires_at, account_id, family, parent_id, user_agent, ip, created_at, last_used_at, client_id)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8, NULLIF($9, ''))`
+	_, err := db.Exec(query, refreshToken, expiresAt, accountID, family, parentID,
+		truncate(origin.UserAgent, maxUserAgentLength), truncate(origin.IP, maxIPLength), now, origin.ClientID)
+	if err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+// RevokeFamily revokes every token of the family which is still usable.
+func RevokeFamily(db Execer, family string) error {
+	query := "UPDATE refresh_token SET revoked_at = $1 WHERE family = $2 AND revoked_at IS NULL"
+	_, err := db.Exec(query, time.Now().UTC(), family)
+	return err
+}
+
+// RevokeAll revokes every usable token of the account, signing it out of all sessions.
+func RevokeAll(db Execer, accountID string) error {
+	query := "UPDATE refresh_token SET revoked_at = $1 WHERE account_id = $2 AND revoked_at IS NULL"
+	_, err := db.Exec(query, time.Now().UTC(), accountID)
+	return err
+}
+
+// RevokeOthers revokes every usable token of the account except those of the session the given
+// refresh token belongs to.
+func RevokeOthers(db Execer, accountID string, refreshToken string) error {
+	query := `UPDATE refresh_token SET revoked_at = $1
+				WHERE account_id = $2 AND revoked_at IS NULL AND family <> COALESCE(
+					(SELECT family FROM refresh_token WHERE value = $3 AND account_id = $2), ''
+				)`
+	_, err := db.Exec(query, time.Now().UTC(), accountID, refreshToken)
+	return err
+}
+
+// truncate cuts the string to at most n bytes on a rune boundary. Headers may carry any bytes, those
+// which aren't valid UTF-8 are dropped first, Postgres would refuse them.
+func truncate(s string, n int) string {
+	s = strings.ToValidUTF8(s, "")
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
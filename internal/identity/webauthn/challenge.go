@@ -0,0 +1,57 @@
+package webauthn
+
+import (
+	"database/sql"
+	"errors"
+	"sw/internal/random"
+	"time"
+)
+
+const (
+	CeremonyRegistration   = "registration"
+	CeremonyAuthentication = "authentication"
+)
+
+type Execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+type QueryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// NewChallenge stores a random challenge for a ceremony. Registrations are bound to the account
+// adding the passkey, sign-ins are not, as the passkey tells whose it is.
+func NewChallenge(db Execer, ceremony string, accountID string) (string, error) {
+	challenge := random.Secret(32)
+	var account sql.NullString
+	if accountID != "" {
+		account = sql.NullString{String: accountID, Valid: true}
+	}
+	query := "INSERT INTO webauthn_challenge (value, ceremony, created_at, account_id) VALUES ($1, $2, $3, $4)"
+	_, err := db.Exec(query, challenge, ceremony, time.Now().UTC(), account)
+	if err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// ConsumeChallenge deletes the challenge, so a response can't be replayed, and returns the account
+// the ceremony was started for, if any. It is meant to run on its own, a response failing verification
+// must not give the challenge back.
+func ConsumeChallenge(db QueryRower, challenge string, ceremony string, lifetime time.Duration) (string, error) {
+	exp := time.Now().UTC().Add(-lifetime)
+	query := `DELETE FROM webauthn_challenge WHERE value = $1 AND ceremony = $2 AND created_at > $3
+				RETURNING account_id`
+	var accountID sql.NullString
+	err := db.QueryRow(query, challenge, ceremony, exp).Scan(&accountID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", InvalidChallengeError
+		}
+		return "", err
+	}
+	return accountID.String, nil
+}
+
+var InvalidChallengeError = errors.New("webauthn challenge is invalid or expired")
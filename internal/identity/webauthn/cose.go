@@ -0,0 +1,121 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// COSE algorithms of RFC 9053 offered to authenticators, in the order of preference.
+const (
+	AlgorithmES256 = -7
+	AlgorithmEdDSA = -8
+	AlgorithmRS256 = -257
+)
+
+var SupportedAlgorithms = []int64{AlgorithmES256, AlgorithmEdDSA, AlgorithmRS256}
+
+// COSE key parameters of RFC 9052 and RFC 9053.
+const (
+	coseKeyType   = 1
+	coseAlgorithm = 3
+	coseCurve     = -1
+	coseX         = -2
+	coseY         = -3
+	coseRSAN      = -1
+	coseRSAE      = -2
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+const minRSAKeyBits = 2048
+
+// PublicKey is a credential public key together with the algorithm its signatures are made with.
+type PublicKey struct {
+	Algorithm int64
+	Key       crypto.PublicKey
+}
+
+// ParsePublicKey decodes a COSE_Key as found in the attested credential data.
+func ParsePublicKey(data []byte) (PublicKey, error) {
+	item, rest, err := decodeCBOR(data)
+	if err != nil {
+		return PublicKey{}, err
+	}
+	if len(rest) != 0 {
+		return PublicKey{}, InvalidPublicKeyError
+	}
+	return parseCOSEKey(item)
+}
+
+func parseCOSEKey(item any) (PublicKey, error) {
+	key, ok := item.(map[any]any)
+	if !ok {
+		return PublicKey{}, InvalidPublicKeyError
+	}
+	kty, _ := key[int64(coseKeyType)].(int64)
+	alg, _ := key[int64(coseAlgorithm)].(int64)
+	switch alg {
+	case AlgorithmES256:
+		crv, _ := key[int64(coseCurve)].(int64)
+		x, _ := key[int64(coseX)].([]byte)
+		y, _ := key[int64(coseY)].([]byte)
+		if kty != coseKeyTypeEC2 || crv != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return PublicKey{}, InvalidPublicKeyError
+		}
+		public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !public.Curve.IsOnCurve(public.X, public.Y) {
+			return PublicKey{}, InvalidPublicKeyError
+		}
+		return PublicKey{Algorithm: alg, Key: public}, nil
+	case AlgorithmEdDSA:
+		crv, _ := key[int64(coseCurve)].(int64)
+		x, _ := key[int64(coseX)].([]byte)
+		if kty != coseKeyTypeOKP || crv != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return PublicKey{}, InvalidPublicKeyError
+		}
+		return PublicKey{Algorithm: alg, Key: ed25519.PublicKey(x)}, nil
+	case AlgorithmRS256:
+		n, _ := key[int64(coseRSAN)].([]byte)
+		e, _ := key[int64(coseRSAE)].([]byte)
+		if kty != coseKeyTypeRSA || len(e) == 0 || len(e) > 4 {
+			return PublicKey{}, InvalidPublicKeyError
+		}
+		public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if public.N.BitLen() < minRSAKeyBits {
+			return PublicKey{}, InvalidPublicKeyError
+		}
+		return PublicKey{Algorithm: alg, Key: public}, nil
+	}
+	return PublicKey{}, UnsupportedAlgorithmError
+}
+
+// Verify checks a signature made by the authenticator over the data.
+func (k PublicKey) Verify(data []byte, signature []byte) bool {
+	switch public := k.Key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(public, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(public, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
+
+var (
+	InvalidPublicKeyError     = errors.New("credential public key is invalid")
+	UnsupportedAlgorithmError = errors.New("credential public key algorithm is not supported")
+)
@@ -0,0 +1,255 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sw/config"
+)
+
+const (
+	clientDataTypeCreate = "webauthn.create"
+	clientDataTypeGet    = "webauthn.get"
+)
+
+// Flags of the authenticator data.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+const (
+	rpIDHashLength  = 32
+	authDataLength  = rpIDHashLength + 1 + 4
+	aaguidLength    = 16
+	maxCredentialID = 1023
+)
+
+// Credential is what a registration ceremony yields to be stored for the account.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+// Assertion is the response of the authenticator to a sign-in ceremony.
+type Assertion struct {
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// RelyingParty verifies the responses of authenticators to the ceremonies of WebAuthn Level 2. User
+// verification is required, so a passkey alone is enough to sign in. Attestation is not requested,
+// the statement of a registration is not verified and any format is accepted.
+type RelyingParty struct {
+	opt config.WebAuthnOptions
+}
+
+func NewRelyingParty(opt config.WebAuthnOptions) *RelyingParty {
+	return &RelyingParty{opt: opt}
+}
+
+// ChallengeOf reads the challenge the client data was made for, so the ceremony it belongs to
+// can be looked up before verifying anything else.
+func ChallengeOf(clientDataJSON []byte) (string, error) {
+	var data clientData
+	err := json.Unmarshal(clientDataJSON, &data)
+	if err != nil || data.Challenge == "" {
+		return "", InvalidClientDataError
+	}
+	return data.Challenge, nil
+}
+
+// VerifyRegistration checks the response to a registration ceremony started with the challenge.
+func (rp *RelyingParty) VerifyRegistration(
+	challenge string,
+	clientDataJSON []byte,
+	attestationObject []byte,
+) (Credential, error) {
+	err := rp.verifyClientData(clientDataJSON, clientDataTypeCreate, challenge)
+	if err != nil {
+		return Credential{}, err
+	}
+	item, rest, err := decodeCBOR(attestationObject)
+	if err != nil || len(rest) != 0 {
+		return Credential{}, InvalidAttestationError
+	}
+	attestation, ok := item.(map[any]any)
+	if !ok {
+		return Credential{}, InvalidAttestationError
+	}
+	if _, ok = attestation["fmt"].(string); !ok {
+		return Credential{}, InvalidAttestationError
+	}
+	raw, ok := attestation["authData"].([]byte)
+	if !ok {
+		return Credential{}, InvalidAttestationError
+	}
+	authData, err := parseAuthenticatorData(raw)
+	if err != nil {
+		return Credential{}, err
+	}
+	err = rp.verifyAuthenticatorData(authData)
+	if err != nil {
+		return Credential{}, err
+	}
+	if authData.flags&flagAttested == 0 {
+		return Credential{}, InvalidAuthenticatorDataError
+	}
+	_, err = ParsePublicKey(authData.publicKey)
+	if err != nil {
+		return Credential{}, err
+	}
+	return Credential{ID: authData.credentialID, PublicKey: authData.publicKey, SignCount: authData.signCount}, nil
+}
+
+// VerifyAssertion checks the response to a sign-in ceremony started with the challenge against the
+// stored public key and returns the new signature counter. A counter not above the stored one, when
+// the authenticator keeps one at all, suggests a cloned authenticator.
+func (rp *RelyingParty) VerifyAssertion(
+	challenge string,
+	publicKey []byte,
+	signCount uint32,
+	assertion Assertion,
+) (uint32, error) {
+	err := rp.verifyClientData(assertion.ClientDataJSON, clientDataTypeGet, challenge)
+	if err != nil {
+		return 0, err
+	}
+	authData, err := parseAuthenticatorData(assertion.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	err = rp.verifyAuthenticatorData(authData)
+	if err != nil {
+		return 0, err
+	}
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(assertion.ClientDataJSON)
+	signed := append(append([]byte(nil), assertion.AuthenticatorData...), clientDataHash[:]...)
+	if !key.Verify(signed, assertion.Signature) {
+		return 0, InvalidSignatureError
+	}
+	if (authData.signCount != 0 || signCount != 0) && authData.signCount <= signCount {
+		return 0, SignCountError
+	}
+	return authData.signCount, nil
+}
+
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge string) error {
+	var data clientData
+	err := json.Unmarshal(clientDataJSON, &data)
+	if err != nil {
+		return InvalidClientDataError
+	}
+	if data.Type != ceremony || data.CrossOrigin || !slices.Contains(rp.opt.Origins, data.Origin) {
+		return InvalidClientDataError
+	}
+	if subtle.ConstantTimeCompare([]byte(data.Challenge), []byte(challenge)) != 1 {
+		return InvalidClientDataError
+	}
+	return nil
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(authData authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.opt.RPID))
+	if !bytes.Equal(authData.rpIDHash, rpIDHash[:]) {
+		return InvalidAuthenticatorDataError
+	}
+	if authData.flags&flagUserPresent == 0 || authData.flags&flagUserVerified == 0 {
+		return UserNotVerifiedError
+	}
+	return nil
+}
+
+// parseAuthenticatorData splits the binary authenticator data, with the attested credential data
+// when its flag is set. Extensions following it are ignored.
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	if len(data) < authDataLength {
+		return authenticatorData{}, InvalidAuthenticatorDataError
+	}
+	authData := authenticatorData{
+		rpIDHash:  data[:rpIDHashLength],
+		flags:     data[rpIDHashLength],
+		signCount: binary.BigEndian.Uint32(data[rpIDHashLength+1:]),
+	}
+	if authData.flags&flagAttested == 0 {
+		return authData, nil
+	}
+	rest := data[authDataLength:]
+	if len(rest) < aaguidLength+2 {
+		return authenticatorData{}, InvalidAuthenticatorDataError
+	}
+	rest = rest[aaguidLength:]
+	length := int(binary.BigEndian.Uint16(rest))
+	rest = rest[2:]
+	if length == 0 || length > maxCredentialID || len(rest) < length {
+		return authenticatorData{}, InvalidAuthenticatorDataError
+	}
+	authData.credentialID = append([]byte(nil), rest[:length]...)
+	rest = rest[length:]
+	// The key is the only CBOR item whose length is not given upfront, decoding it tells where it ends.
+	_, after, err := decodeCBOR(rest)
+	if err != nil {
+		return authenticatorData{}, InvalidAuthenticatorDataError
+	}
+	authData.publicKey = append([]byte(nil), rest[:len(rest)-len(after)]...)
+	return authData, nil
+}
+
+// IsVerificationError tells whether the error is about the response of the authenticator, rather than
+// a failure of the server.
+func IsVerificationError(err error) bool {
+	switch err {
+	case InvalidClientDataError,
+		InvalidAttestationError,
+		InvalidAuthenticatorDataError,
+		UserNotVerifiedError,
+		InvalidSignatureError,
+		SignCountError,
+		InvalidPublicKeyError,
+		UnsupportedAlgorithmError:
+		return true
+	}
+	return false
+}
+
+// DecodeBase64URL accepts the unpadded base64url WebAuthn JSON uses, and padded input as well.
+func DecodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+var (
+	InvalidClientDataError        = errors.New("client data is invalid")
+	InvalidAttestationError       = errors.New("attestation object is invalid")
+	InvalidAuthenticatorDataError = errors.New("authenticator data is invalid")
+	UserNotVerifiedError          = errors.New("user was not verified by the authenticator")
+	InvalidSignatureError         = errors.New("assertion signature is invalid")
+	SignCountError                = errors.New("signature counter did not increase")
+)
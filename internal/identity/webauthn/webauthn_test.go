@@ -0,0 +1,341 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"sw/config"
+	"testing"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+func testRelyingParty() *RelyingParty {
+	return NewRelyingParty(config.WebAuthnOptions{RPID: testRPID, Origins: []string{testOrigin}})
+}
+
+// testItem encodes the subset of CBOR decodeCBOR reads: integers, byte and text strings, and maps
+// with the entries in the given order.
+type testItem interface{ encode() []byte }
+
+type (
+	testInt   int64
+	testBytes []byte
+	testText  string
+	testMap   []testEntry
+)
+
+type testEntry struct{ key, value testItem }
+
+func testHead(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major<<5 | 24, byte(arg)}
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(arg))
+	}
+	return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(arg))
+}
+
+func (i testInt) encode() []byte {
+	if i < 0 {
+		return testHead(1, uint64(-1-i))
+	}
+	return testHead(0, uint64(i))
+}
+
+func (b testBytes) encode() []byte { return append(testHead(2, uint64(len(b))), b...) }
+
+func (t testText) encode() []byte { return append(testHead(3, uint64(len(t))), t...) }
+
+func (m testMap) encode() []byte {
+	out := testHead(5, uint64(len(m)))
+	for _, entry := range m {
+		out = append(out, entry.key.encode()...)
+		out = append(out, entry.value.encode()...)
+	}
+	return out
+}
+
+// softAuthenticator plays a platform authenticator holding a single passkey.
+type softAuthenticator struct {
+	credentialID []byte
+	coseKey      []byte
+	sign         func(data []byte) []byte
+	signCount    uint32
+}
+
+func newES256Authenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := key.X.FillBytes(make([]byte, 32))
+	y := key.Y.FillBytes(make([]byte, 32))
+	coseKey := testMap{
+		{testInt(coseKeyType), testInt(coseKeyTypeEC2)},
+		{testInt(coseAlgorithm), testInt(AlgorithmES256)},
+		{testInt(coseCurve), testInt(coseCurveP256)},
+		{testInt(coseX), testBytes(x)},
+		{testInt(coseY), testBytes(y)},
+	}
+	return &softAuthenticator{
+		credentialID: randomBytes(t, 32),
+		coseKey:      coseKey.encode(),
+		sign: func(data []byte) []byte {
+			digest := sha256.Sum256(data)
+			signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return signature
+		},
+	}
+}
+
+func newEdDSAAuthenticator(t *testing.T) *softAuthenticator {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coseKey := testMap{
+		{testInt(coseKeyType), testInt(coseKeyTypeOKP)},
+		{testInt(coseAlgorithm), testInt(AlgorithmEdDSA)},
+		{testInt(coseCurve), testInt(coseCurveEd25519)},
+		{testInt(coseX), testBytes(public)},
+	}
+	return &softAuthenticator{
+		credentialID: randomBytes(t, 16),
+		coseKey:      coseKey.encode(),
+		sign:         func(data []byte) []byte { return ed25519.Sign(private, data) },
+	}
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func clientDataJSON(ceremony string, challenge string, origin string) []byte {
+	data, _ := json.Marshal(clientData{Type: ceremony, Challenge: challenge, Origin: origin})
+	return data
+}
+
+func (a *softAuthenticator) authData(flags byte, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, aaguidLength)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, a.coseKey...)
+	}
+	return data
+}
+
+func (a *softAuthenticator) attestationObject(authData []byte) []byte {
+	return testMap{
+		{testText("fmt"), testText("none")},
+		{testText("attStmt"), testMap{}},
+		{testText("authData"), testBytes(authData)},
+	}.encode()
+}
+
+func (a *softAuthenticator) create(challenge string) ([]byte, []byte) {
+	authData := a.authData(flagUserPresent|flagUserVerified|flagAttested, true)
+	return clientDataJSON(clientDataTypeCreate, challenge, testOrigin), a.attestationObject(authData)
+}
+
+func (a *softAuthenticator) get(challenge string) Assertion {
+	a.signCount++
+	authData := a.authData(flagUserPresent|flagUserVerified, false)
+	clientData := clientDataJSON(clientDataTypeGet, challenge, testOrigin)
+	clientDataHash := sha256.Sum256(clientData)
+	signature := a.sign(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	return Assertion{ClientDataJSON: clientData, AuthenticatorData: authData, Signature: signature}
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	authenticators := map[string]func(t *testing.T) *softAuthenticator{
+		"ES256": newES256Authenticator,
+		"EdDSA": newEdDSAAuthenticator,
+	}
+	for name, newAuthenticator := range authenticators {
+		t.Run(name, func(t *testing.T) {
+			rp := testRelyingParty()
+			authenticator := newAuthenticator(t)
+
+			clientData, attestation := authenticator.create("registration-challenge")
+			credential, err := rp.VerifyRegistration("registration-challenge", clientData, attestation)
+			if err != nil {
+				t.Fatalf("registration failed: %v", err)
+			}
+			if string(credential.ID) != string(authenticator.credentialID) {
+				t.Fatal("credential ID does not match the authenticator")
+			}
+
+			signCount := credential.SignCount
+			for _, challenge := range []string{"first-challenge", "second-challenge"} {
+				signCount, err = rp.VerifyAssertion(challenge, credential.PublicKey, signCount,
+					authenticator.get(challenge))
+				if err != nil {
+					t.Fatalf("assertion failed: %v", err)
+				}
+				if signCount != authenticator.signCount {
+					t.Fatalf("sign count is %d, want %d", signCount, authenticator.signCount)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyRegistrationRejectsMalformedResponses(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := newES256Authenticator(t)
+	const challenge = "registration-challenge"
+	clientData, attestation := authenticator.create(challenge)
+	valid := authenticator.authData(flagUserPresent|flagUserVerified|flagAttested, true)
+
+	cases := []struct {
+		name        string
+		clientData  []byte
+		attestation []byte
+		want        error
+	}{
+		{"client data is not JSON", []byte("{"), attestation, InvalidClientDataError},
+		{"wrong ceremony", clientDataJSON(clientDataTypeGet, challenge, testOrigin), attestation,
+			InvalidClientDataError},
+		{"wrong challenge", clientDataJSON(clientDataTypeCreate, "other", testOrigin), attestation,
+			InvalidClientDataError},
+		{"wrong origin", clientDataJSON(clientDataTypeCreate, challenge, "https://evil.example"), attestation,
+			InvalidClientDataError},
+		{"attestation is not CBOR", clientData, []byte{0xff}, InvalidAttestationError},
+		{"attestation is truncated", clientData, attestation[:len(attestation)-1], InvalidAttestationError},
+		{"attestation has trailing bytes", clientData, append(append([]byte(nil), attestation...), 0),
+			InvalidAttestationError},
+		{"attestation is not a map", clientData, testText("none").encode(), InvalidAttestationError},
+		{"authData is truncated", clientData, authenticator.attestationObject(valid[:authDataLength-1]),
+			InvalidAuthenticatorDataError},
+		{"attested credential data is truncated", clientData,
+			authenticator.attestationObject(valid[:authDataLength+aaguidLength+2+4]), InvalidAuthenticatorDataError},
+		{"wrong RP ID", clientData, authenticator.attestationObject(append([]byte{^valid[0]}, valid[1:]...)),
+			InvalidAuthenticatorDataError},
+		{"user not verified", clientData,
+			authenticator.attestationObject(authenticator.authData(flagUserPresent|flagAttested, true)),
+			UserNotVerifiedError},
+		{"no attested credential data", clientData,
+			authenticator.attestationObject(authenticator.authData(flagUserPresent|flagUserVerified, false)),
+			InvalidAuthenticatorDataError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := rp.VerifyRegistration(challenge, tc.clientData, tc.attestation)
+			if err != tc.want {
+				t.Fatalf("got %v, want %v", err, tc.want)
+			}
+			if !IsVerificationError(err) {
+				t.Fatalf("%v is not a verification error", err)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionRejectsMalformedResponses(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := newES256Authenticator(t)
+	clientData, attestation := authenticator.create("registration-challenge")
+	credential, err := rp.VerifyRegistration("registration-challenge", clientData, attestation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const challenge = "authentication-challenge"
+
+	badSignature := authenticator.get(challenge)
+	badSignature.Signature = append([]byte(nil), badSignature.Signature...)
+	badSignature.Signature[len(badSignature.Signature)-1] ^= 0x01
+
+	tampered := authenticator.get(challenge)
+	tampered.AuthenticatorData = append([]byte(nil), tampered.AuthenticatorData...)
+	tampered.AuthenticatorData[len(tampered.AuthenticatorData)-1]++
+
+	notVerified := authenticator.get(challenge)
+	notVerified.AuthenticatorData = append([]byte(nil), notVerified.AuthenticatorData...)
+	notVerified.AuthenticatorData[rpIDHashLength] &^= flagUserVerified
+
+	truncated := authenticator.get(challenge)
+	truncated.AuthenticatorData = truncated.AuthenticatorData[:authDataLength-1]
+
+	otherKey := newEdDSAAuthenticator(t)
+
+	cases := []struct {
+		name      string
+		assertion Assertion
+		publicKey []byte
+		signCount uint32
+		want      error
+	}{
+		{"wrong challenge", authenticator.get("other"), credential.PublicKey, 0, InvalidClientDataError},
+		{"bad signature", badSignature, credential.PublicKey, 0, InvalidSignatureError},
+		{"tampered authenticator data", tampered, credential.PublicKey, 0, InvalidSignatureError},
+		{"user not verified", notVerified, credential.PublicKey, 0, UserNotVerifiedError},
+		{"authenticator data is truncated", truncated, credential.PublicKey, 0, InvalidAuthenticatorDataError},
+		{"signed by another key", authenticator.get(challenge), otherKey.coseKey, 0, InvalidSignatureError},
+		{"counter replayed", authenticator.get(challenge), credential.PublicKey, authenticator.signCount + 1,
+			SignCountError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := rp.VerifyAssertion(challenge, tc.publicKey, tc.signCount, tc.assertion)
+			if err != tc.want {
+				t.Fatalf("got %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCBORRejectsMalformedInput(t *testing.T) {
+	cases := map[string][]byte{
+		"empty":                 {},
+		"indefinite length":     {0x5f},
+		"reserved argument":     {0x1c},
+		"truncated argument":    {0x19, 0x01},
+		"truncated byte string": {0x45, 0x01, 0x02},
+		"truncated map":         {0xa2, 0x01, 0x02},
+		"array longer than data": {
+			0x9a, 0xff, 0xff, 0xff, 0xff,
+		},
+		"duplicate map key":    {0xa2, 0x01, 0x01, 0x01, 0x02},
+		"byte string map key":  {0xa1, 0x41, 0x00, 0x01},
+		"floating point value": {0xfa, 0x00, 0x00, 0x00, 0x00},
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := decodeCBOR(data)
+			if err != CBORError {
+				t.Fatalf("got %v, want %v", err, CBORError)
+			}
+		})
+	}
+
+	nested := make([]byte, cborMaxDepth+2)
+	for i := range nested {
+		nested[i] = 0x81
+	}
+	if _, _, err := decodeCBOR(nested); err != CBORError {
+		t.Fatalf("nesting beyond the limit: got %v, want %v", err, CBORError)
+	}
+}
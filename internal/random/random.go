@@ -1,6 +1,11 @@
 package random
 
-import "math/rand"
+import (
+	crand "crypto/rand"
+	"encoding/base64"
+	"math/big"
+	"math/rand"
+)
 
 const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
@@ -11,3 +16,29 @@ func String(n int) string {
 	}
 	return string(b)
 }
+
+// Secret returns n random bytes from a cryptographically secure source encoded as base64url, for values
+// which grant access on their own, like client secrets.
+func Secret(n int) string {
+	b := make([]byte, n)
+	_, err := crand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Code returns n characters picked from the alphabet by a cryptographically secure source, for short
+// codes people have to type.
+func Code(n int, alphabet string) string {
+	b := make([]byte, n)
+	max := big.NewInt(int64(len(alphabet)))
+	for i := range b {
+		index, err := crand.Int(crand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = alphabet[index.Int64()]
+	}
+	return string(b)
+}
@@ -0,0 +1,8 @@
+BEGIN;
+DROP TABLE refresh_token_reuse;
+DROP INDEX refresh_token_family_idx;
+ALTER TABLE refresh_token DROP COLUMN revoked_at;
+ALTER TABLE refresh_token DROP COLUMN rotated_at;
+ALTER TABLE refresh_token DROP COLUMN parent_id;
+ALTER TABLE refresh_token DROP COLUMN family;
+COMMIT;
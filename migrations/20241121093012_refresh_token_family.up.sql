@@ -0,0 +1,17 @@
+BEGIN;
+ALTER TABLE refresh_token ADD COLUMN family varchar(64);
+UPDATE refresh_token SET family = value;
+ALTER TABLE refresh_token ALTER COLUMN family SET NOT NULL;
+ALTER TABLE refresh_token ADD COLUMN parent_id integer REFERENCES refresh_token (id) ON DELETE SET NULL;
+ALTER TABLE refresh_token ADD COLUMN rotated_at timestamp;
+ALTER TABLE refresh_token ADD COLUMN revoked_at timestamp;
+CREATE INDEX refresh_token_family_idx ON refresh_token (family);
+CREATE TABLE refresh_token_reuse
+(
+    id serial PRIMARY KEY,
+    refresh_token_id integer NOT NULL,
+    family varchar(64) NOT NULL,
+    account_id bigint NOT NULL REFERENCES account (id),
+    detected_at timestamp NOT NULL
+);
+COMMIT;
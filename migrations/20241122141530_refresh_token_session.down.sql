@@ -0,0 +1,7 @@
+BEGIN;
+DROP INDEX refresh_token_account_id_idx;
+ALTER TABLE refresh_token DROP COLUMN last_used_at;
+ALTER TABLE refresh_token DROP COLUMN created_at;
+ALTER TABLE refresh_token DROP COLUMN ip;
+ALTER TABLE refresh_token DROP COLUMN user_agent;
+COMMIT;
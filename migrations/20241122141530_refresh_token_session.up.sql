@@ -0,0 +1,9 @@
+BEGIN;
+ALTER TABLE refresh_token ADD COLUMN user_agent varchar(512) NOT NULL DEFAULT '';
+ALTER TABLE refresh_token ADD COLUMN ip varchar(45) NOT NULL DEFAULT '';
+ALTER TABLE refresh_token ADD COLUMN created_at timestamp NOT NULL DEFAULT (now() AT TIME ZONE 'utc');
+ALTER TABLE refresh_token ADD COLUMN last_used_at timestamp NOT NULL DEFAULT (now() AT TIME ZONE 'utc');
+ALTER TABLE refresh_token ALTER COLUMN created_at DROP DEFAULT;
+ALTER TABLE refresh_token ALTER COLUMN last_used_at DROP DEFAULT;
+CREATE INDEX refresh_token_account_id_idx ON refresh_token (account_id);
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+DROP TABLE oauth_authorization_code;
+DROP TABLE oauth_client_redirect_uri;
+DROP TABLE oauth_client;
+COMMIT;
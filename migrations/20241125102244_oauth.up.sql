@@ -0,0 +1,28 @@
+BEGIN;
+CREATE TABLE oauth_client
+(
+    id serial PRIMARY KEY,
+    client_id varchar(64) NOT NULL UNIQUE,
+    name varchar(255) NOT NULL,
+    created_at timestamp NOT NULL
+);
+CREATE TABLE oauth_client_redirect_uri
+(
+    id serial PRIMARY KEY,
+    client_id integer NOT NULL REFERENCES oauth_client (id) ON DELETE CASCADE,
+    uri varchar(2048) NOT NULL,
+    UNIQUE (client_id, uri)
+);
+CREATE TABLE oauth_authorization_code
+(
+    id serial PRIMARY KEY,
+    value varchar(64) NOT NULL UNIQUE,
+    client_id integer NOT NULL REFERENCES oauth_client (id) ON DELETE CASCADE,
+    account_id bigint NOT NULL REFERENCES account (id),
+    redirect_uri varchar(2048) NOT NULL,
+    scope varchar(1024) NOT NULL,
+    nonce varchar(256) NOT NULL,
+    code_challenge varchar(128) NOT NULL,
+    created_at timestamp NOT NULL
+);
+COMMIT;
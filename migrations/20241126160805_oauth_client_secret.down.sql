@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE oauth_client DROP COLUMN scopes;
+ALTER TABLE oauth_client DROP COLUMN secret_hash;
+COMMIT;
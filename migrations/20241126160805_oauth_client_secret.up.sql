@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE oauth_client ADD COLUMN secret_hash varchar(255);
+ALTER TABLE oauth_client ADD COLUMN scopes varchar(1024) NOT NULL DEFAULT '';
+COMMIT;
@@ -0,0 +1 @@
+DROP TABLE oauth_device_code;
@@ -0,0 +1,14 @@
+CREATE TABLE oauth_device_code
+(
+    id serial PRIMARY KEY,
+    device_code varchar(64) NOT NULL UNIQUE,
+    user_code varchar(16) NOT NULL UNIQUE,
+    client_id integer NOT NULL REFERENCES oauth_client (id) ON DELETE CASCADE,
+    scope varchar(1024) NOT NULL,
+    status varchar(16) NOT NULL,
+    account_id bigint REFERENCES account (id),
+    approved_at timestamp,
+    interval_seconds integer NOT NULL,
+    last_polled_at timestamp,
+    expires_at timestamp NOT NULL
+);
@@ -0,0 +1 @@
+DROP TABLE email_change_token;
\ No newline at end of file
@@ -0,0 +1,9 @@
+CREATE TABLE email_change_token
+(
+    id serial PRIMARY KEY,
+    value varchar(64) NOT NULL UNIQUE,
+    cancel_value varchar(64) NOT NULL UNIQUE,
+    new_email citext NOT NULL,
+    created_at timestamp NOT NULL,
+    account_id bigint NOT NULL REFERENCES account (id)
+);
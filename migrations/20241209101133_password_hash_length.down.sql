@@ -0,0 +1 @@
+ALTER TABLE account ALTER COLUMN password_hash TYPE varchar(64);
\ No newline at end of file
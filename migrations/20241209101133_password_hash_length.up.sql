@@ -0,0 +1 @@
+ALTER TABLE account ALTER COLUMN password_hash TYPE varchar(255);
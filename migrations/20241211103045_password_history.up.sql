@@ -0,0 +1,10 @@
+BEGIN;
+CREATE TABLE password_history
+(
+    id bigserial PRIMARY KEY,
+    account_id bigint NOT NULL REFERENCES account (id),
+    password_hash varchar(255) NOT NULL,
+    created_at timestamp NOT NULL
+);
+CREATE INDEX password_history_account_id_idx ON password_history (account_id, created_at);
+COMMIT;
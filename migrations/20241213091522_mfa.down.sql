@@ -0,0 +1,4 @@
+BEGIN;
+DROP TABLE mfa_challenge;
+DROP TABLE account_totp;
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,19 @@
+BEGIN;
+CREATE TABLE account_totp
+(
+    account_id bigint PRIMARY KEY REFERENCES account (id),
+    secret varchar(64) NOT NULL,
+    last_used_step bigint NOT NULL DEFAULT 0,
+    activated_at timestamp,
+    created_at timestamp NOT NULL
+);
+CREATE TABLE mfa_challenge
+(
+    id serial PRIMARY KEY,
+    value varchar(64) NOT NULL UNIQUE,
+    nonce varchar(256) NOT NULL,
+    attempts int NOT NULL DEFAULT 0,
+    created_at timestamp NOT NULL,
+    account_id bigint NOT NULL REFERENCES account (id)
+);
+COMMIT;
@@ -0,0 +1 @@
+DROP TABLE mfa_recovery_code;
\ No newline at end of file
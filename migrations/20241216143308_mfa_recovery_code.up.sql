@@ -0,0 +1,8 @@
+CREATE TABLE mfa_recovery_code
+(
+    id serial PRIMARY KEY,
+    code_hash varchar(255) NOT NULL,
+    used_at timestamp,
+    created_at timestamp NOT NULL,
+    account_id bigint NOT NULL REFERENCES account (id)
+);
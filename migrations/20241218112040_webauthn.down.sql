@@ -0,0 +1,4 @@
+BEGIN;
+DROP TABLE webauthn_challenge;
+DROP TABLE webauthn_credential;
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,21 @@
+BEGIN;
+CREATE TABLE webauthn_credential
+(
+    id serial PRIMARY KEY,
+    credential_id bytea NOT NULL UNIQUE,
+    public_key bytea NOT NULL,
+    sign_count bigint NOT NULL,
+    name varchar(64) NOT NULL,
+    created_at timestamp NOT NULL,
+    last_used_at timestamp,
+    account_id bigint NOT NULL REFERENCES account (id)
+);
+CREATE TABLE webauthn_challenge
+(
+    id serial PRIMARY KEY,
+    value varchar(64) NOT NULL UNIQUE,
+    ceremony varchar(16) NOT NULL,
+    created_at timestamp NOT NULL,
+    account_id bigint REFERENCES account (id)
+);
+COMMIT;
@@ -0,0 +1 @@
+DROP TABLE magic_link_token;
\ No newline at end of file
@@ -0,0 +1,7 @@
+CREATE TABLE magic_link_token
+(
+    id serial PRIMARY KEY,
+    value varchar(64) NOT NULL UNIQUE,
+    created_at timestamp NOT NULL,
+    account_id bigint NOT NULL REFERENCES account (id)
+);
@@ -0,0 +1 @@
+DROP TABLE email_otp;
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE email_otp
+(
+    id serial PRIMARY KEY,
+    purpose varchar(16) NOT NULL,
+    code varchar(6) NOT NULL,
+    attempts int NOT NULL DEFAULT 0,
+    created_at timestamp NOT NULL,
+    locked_until timestamp,
+    account_id bigint NOT NULL REFERENCES account (id),
+    UNIQUE (account_id, purpose)
+);
@@ -0,0 +1 @@
+ALTER TABLE refresh_token DROP COLUMN client_id;
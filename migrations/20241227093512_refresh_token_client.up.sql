@@ -0,0 +1 @@
+ALTER TABLE refresh_token ADD COLUMN client_id varchar(64);
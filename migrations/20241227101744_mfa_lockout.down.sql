@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE account_totp DROP COLUMN locked_until;
+ALTER TABLE account_totp DROP COLUMN failed_attempts;
+COMMIT;
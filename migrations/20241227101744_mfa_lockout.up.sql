@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE account_totp ADD COLUMN failed_attempts int NOT NULL DEFAULT 0;
+ALTER TABLE account_totp ADD COLUMN locked_until timestamp;
+COMMIT;